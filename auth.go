@@ -0,0 +1,246 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/x-mod/errors"
+)
+
+//ErrEmptyCredential the authenticator got an empty token or key
+var ErrEmptyCredential = errors.New("empty credential")
+
+//Authenticator authorize the request, invoked for every attempt of the request
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request) error
+}
+
+//ChallengeHandler optional interface of Authenticator, invoked on a 401 response (WWW-Authenticate).
+//With retry true the request is authenticated & sent once more. It must not consume the response body.
+type ChallengeHandler interface {
+	HandleChallenge(ctx context.Context, req *http.Request, rsp *http.Response) (retry bool, err error)
+}
+
+//AuthenticatorFunc custom authenticator
+type AuthenticatorFunc func(ctx context.Context, req *http.Request) error
+
+//Authenticate implemention of Authenticator
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, req *http.Request) error {
+	return f(ctx, req)
+}
+
+//CredentialFunc get the credential, eg. a token, per request
+type CredentialFunc func(ctx context.Context) (string, error)
+
+//Basic authenticator (RFC 7617)
+func Basic(username string, password string) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+//Bearer authenticator (RFC 6750), an empty token fails with ErrEmptyCredential
+func Bearer(token string) Authenticator {
+	return SchemeAuth("Bearer", func(context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+//BearerFunc authenticator, the token is got per request
+func BearerFunc(token CredentialFunc) Authenticator {
+	return SchemeAuth("Bearer", token)
+}
+
+//SchemeAuth authenticator of a custom Authorization scheme, eg. "Token" or "SSWS",
+//an empty credential fails with ErrEmptyCredential
+func SchemeAuth(scheme string, credential CredentialFunc) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, req *http.Request) error {
+		v, err := credential(ctx)
+		if err != nil {
+			return errors.Errorf("%s credential: %w", scheme, err)
+		}
+		if len(v) == 0 {
+			return errors.Errorf("%w: %s", ErrEmptyCredential, scheme)
+		}
+		req.Header.Set("Authorization", scheme+" "+v)
+		return nil
+	})
+}
+
+//KeyLocation where the api key is sent
+type KeyLocation int
+
+//api key locations
+const (
+	KeyInHeader KeyLocation = iota
+	KeyInQuery
+	KeyInCookie
+)
+
+//APIKey authenticator, send the key by the header, query param or cookie of the name
+func APIKey(in KeyLocation, name string, key string) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, req *http.Request) error {
+		if len(key) == 0 {
+			return errors.Errorf("%w: api key %s", ErrEmptyCredential, name)
+		}
+		switch in {
+		case KeyInHeader:
+			req.Header.Set(name, key)
+		case KeyInQuery:
+			q := req.URL.Query()
+			q.Set(name, key)
+			req.URL.RawQuery = q.Encode()
+		case KeyInCookie:
+			cookies := req.Cookies()
+			req.Header.Del("Cookie")
+			for _, c := range cookies {
+				if c.Name != name {
+					req.AddCookie(c)
+				}
+			}
+			req.AddCookie(&http.Cookie{Name: name, Value: key})
+		default:
+			return errors.Errorf("api key location %d unsupported", in)
+		}
+		return nil
+	})
+}
+
+//ChainAuth authenticator, apply the authenticators in order, eg. an api key & a bearer token.
+//A challenge is handled by the first handler asking to retry.
+func ChainAuth(auths ...Authenticator) Authenticator {
+	return chainAuth(auths)
+}
+
+type chainAuth []Authenticator
+
+//Authenticate implemention of Authenticator
+func (chain chainAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	for _, a := range chain {
+		if err := a.Authenticate(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//HandleChallenge implemention of ChallengeHandler
+func (chain chainAuth) HandleChallenge(ctx context.Context, req *http.Request, rsp *http.Response) (bool, error) {
+	for _, a := range chain {
+		if h, ok := a.(ChallengeHandler); ok {
+			retry, err := h.HandleChallenge(ctx, req, rsp)
+			if err != nil || retry {
+				return retry, err
+			}
+		}
+	}
+	return false, nil
+}
+
+//Auth opt, authorize the request by the authenticator, override the client's Authentication
+func Auth(a Authenticator) ReqOpt {
+	return func(cf *requestConfig) {
+		cf.setAuth("Auth", a)
+	}
+}
+
+//Authentication opt, authorize every request without an Authorization of its own
+func Authentication(a Authenticator) Opt {
+	return func(cf *config) {
+		cf.auth = a
+	}
+}
+
+type namedAuth struct {
+	name string
+	auth Authenticator
+}
+
+func (cf *requestConfig) setAuth(name string, a Authenticator) {
+	for i, v := range cf.auths {
+		if v.name == name {
+			cf.auths[i].auth = a
+			return
+		}
+	}
+	cf.auths = append(cf.auths, namedAuth{name: name, auth: a})
+}
+
+//authenticator of the request, or the client's unless the request has an Authorization
+func (c *Client) authenticator(req *http.Request) Authenticator {
+	if options := requestOptionsFrom(req.Context()); options != nil && options.auth != nil {
+		return options.auth
+	}
+	if len(req.Header.Get("Authorization")) > 0 {
+		return nil
+	}
+	return c.config.auth
+}
+
+//prepare a copy of the request with a fresh body, authenticated & signed
+func prepare(ctx context.Context, a Authenticator, s Signer, req *http.Request) (*http.Request, error) {
+	r, err := rewind(req)
+	if err != nil {
+		return nil, err
+	}
+	if a != nil {
+		if err := a.Authenticate(ctx, r); err != nil {
+			return nil, err
+		}
+	}
+	if s != nil {
+		if err := s.Sign(ctx, r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+//send the request once, with a fresh body, authenticated & signed per attempt; a 401 challenge handled by the authenticator is sent once more
+func (c *Client) send(ctx context.Context, req *http.Request, tc timeoutConfig) (*http.Response, error) {
+	a, s := c.authenticator(req), c.signer(req)
+	r, err := prepare(ctx, a, s, req)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := c.attempt(ctx, r, tc)
+	if err != nil || rsp.StatusCode != http.StatusUnauthorized || !replayable(req) {
+		return rsp, err
+	}
+	handler, ok := a.(ChallengeHandler)
+	if !ok {
+		return rsp, nil
+	}
+	retry, err := handler.HandleChallenge(ctx, r, rsp)
+	if err != nil {
+		drainBody(rsp.Body)
+		return nil, err
+	}
+	if !retry {
+		return rsp, nil
+	}
+	drainBody(rsp.Body)
+	if r, err = prepare(ctx, a, s, req); err != nil {
+		return nil, err
+	}
+	return c.attempt(ctx, r, tc)
+}
+
+//replayable the request body can be sent again
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+//rewind a copy of the request with a fresh body & headers
+func rewind(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, errors.Annotate(err, "request body rewind")
+		}
+		r.Body = body
+	}
+	return r, nil
+}
@@ -0,0 +1,162 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type rotatingAuth struct {
+	t          *testing.T
+	token      string
+	challenged int
+}
+
+func (a *rotatingAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", "Token "+a.token)
+	return nil
+}
+
+func (a *rotatingAuth) HandleChallenge(ctx context.Context, req *http.Request, rsp *http.Response) (bool, error) {
+	a.challenged++
+	assert.Equal(a.t, `Token realm="api"`, rsp.Header.Get("WWW-Authenticate"))
+	a.token = "new"
+	return true, nil
+}
+
+func TestAuthenticator(t *testing.T) {
+	//authenticated per attempt, not when made
+	req, err := MakeRequest(SetURL("http://host"), BearerAuthFunc(func() string { return "" }))
+	assert.Nil(t, err)
+	assert.Empty(t, req.Header.Get("Authorization"))
+	_, err = New().Do(req)
+	assert.True(t, errors.Is(err, ErrEmptyCredential))
+
+	req, err = MakeRequest(SetURL("http://host/?a=1"), Cookie(&http.Cookie{Name: "key", Value: "old"}),
+		Auth(ChainAuth(APIKey(KeyInQuery, "key", "q"), APIKey(KeyInCookie, "key", "c"), APIKey(KeyInHeader, "X-Key", "h"), Bearer("t"))))
+	assert.Nil(t, err)
+	req, err = prepare(context.TODO(), requestOptionsFrom(req.Context()).auth, nil, req)
+	assert.Nil(t, err)
+	assert.Equal(t, "a=1&key=q", req.URL.RawQuery)
+	assert.Equal(t, "key=c", req.Header.Get("Cookie"))
+	assert.Equal(t, "h", req.Header.Get("X-Key"))
+	assert.Equal(t, "Bearer t", req.Header.Get("Authorization"))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Token old" {
+			w.Header().Set("WWW-Authenticate", `Token realm="api"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Header.Get("Authorization") + "|" + string(b)))
+	}))
+	defer ts.Close()
+
+	client := New(BaseURL(ts.URL), Authentication(SchemeAuth("SSWS", func(context.Context) (string, error) {
+		return "client", nil
+	})))
+	get := func(opts ...ReqOpt) string {
+		captured := &Captured{}
+		req, err := client.MakeRequest(opts...)
+		if assert.Nil(t, err) {
+			assert.Nil(t, client.Execute(context.TODO(), req, Capture(captured)))
+		}
+		return string(captured.Body)
+	}
+	assert.Equal(t, "SSWS client|", get())
+	assert.Equal(t, "Bearer req|", get(BearerAuth("req")))
+	assert.Equal(t, "Custom x|", get(Header("Authorization", "Custom x")))
+
+	//the challenge is handled & the body is sent again
+	rotating := &rotatingAuth{t: t, token: "old"}
+	assert.Equal(t, "Token new|body", get(Method("POST"), Auth(rotating), Content(Text("body"))))
+	assert.Equal(t, 1, rotating.challenged)
+}
+
+func TestDigest(t *testing.T) {
+	//RFC 7616 3.9.1
+	d := Digest("Mufasa", "Circle of Life").(*digestAuth)
+	c := &digestChallenge{
+		realm:  "http-auth@example.org",
+		nonce:  "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		opaque: "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+		qop:    "auth",
+	}
+	cnonce := "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+	c.algorithm = "MD5"
+	assert.Contains(t, d.authorization(c, "GET", "/dir/index.html", 1, cnonce, ""), `response="8ca523f5e9506fed4657c9700eebdbec"`)
+	c.algorithm = "SHA-256"
+	assert.Contains(t, d.authorization(c, "GET", "/dir/index.html", 1, cnonce, ""), `response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"`)
+
+	challenges := parseChallenges([]string{`Basic realm="x", Digest realm="a, b", qop="auth,auth-int", algorithm=SHA-256, nonce="n1"`})
+	if assert.Len(t, challenges, 2) {
+		assert.Equal(t, "a, b", challenges[1].params["realm"])
+		assert.Equal(t, "SHA-256", challenges[1].params["algorithm"])
+	}
+
+	challenged := 0
+	ncs := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reply := parseChallenges([]string{r.Header.Get("Authorization")})
+		if len(reply) == 0 || reply[0].scheme != "Digest" {
+			challenged++
+			w.Header().Add("WWW-Authenticate", `Basic realm="api"`)
+			w.Header().Add("WWW-Authenticate", `Digest realm="api", qop="auth-int", algorithm=MD5, nonce="n1", opaque="o"`)
+			w.Header().Add("WWW-Authenticate", `Digest realm="api", qop="auth-int", algorithm=SHA-256-sess, nonce="n1", opaque="o"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		p := reply[0].params
+		server := &digestAuth{username: "user", password: "pass"}
+		var nc uint32
+		fmt.Sscanf(p["nc"], "%x", &nc)
+		expected := server.authorization(&digestChallenge{realm: "api", nonce: "n1", opaque: "o", algorithm: "SHA-256-SESS", qop: "auth-int"},
+			r.Method, r.URL.RequestURI(), nc, p["cnonce"], fmt.Sprintf("%x", sha256.Sum256(b)))
+		if expected != r.Header.Get("Authorization") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ncs = append(ncs, p["nc"])
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	client := New(BaseURL(ts.URL), Authentication(Digest("user", "pass")))
+	post := func(body string) error {
+		req, err := client.MakeRequest(Method("POST"), SetURL("/api?q=1"), Content(Text(body)))
+		if err != nil {
+			return err
+		}
+		captured := &Captured{}
+		if err := client.Execute(context.TODO(), req, Capture(captured)); err != nil {
+			return err
+		}
+		assert.Equal(t, body, string(captured.Body))
+		return nil
+	}
+	assert.Nil(t, post("first"))
+	assert.Nil(t, post("second"))
+	assert.Equal(t, 1, challenged)
+	if assert.Len(t, ncs, 2) {
+		assert.True(t, ncs[0] < ncs[1])
+	}
+
+	//wrong credentials are not retried again & again
+	bad := New(BaseURL(ts.URL), Authentication(Digest("user", "wrong")))
+	req, err := bad.MakeRequest(SetURL("/api"))
+	assert.Nil(t, err)
+	rsp, err := bad.Do(req)
+	if assert.Nil(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+		rsp.Body.Close()
+	}
+}
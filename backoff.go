@@ -0,0 +1,45 @@
+package httpclient
+
+import (
+	"context"
+	"time"
+)
+
+//BackoffFunc delay before the attempt, attempt starts from 1
+type BackoffFunc func(attempt int) time.Duration
+
+//ExponentialBackoff base * 2^(attempt-1), at most max
+func ExponentialBackoff(base time.Duration, max time.Duration) BackoffFunc {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+//ConstantBackoff the same delay for every attempt
+func ConstantBackoff(delay time.Duration) BackoffFunc {
+	return func(int) time.Duration {
+		return delay
+	}
+}
+
+//sleep for the duration unless the context is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
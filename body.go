@@ -2,34 +2,27 @@ package httpclient
 
 import (
 	"bytes"
-	"encoding/xml"
 	"io"
 	"net/url"
+	"reflect"
 	"strings"
 
-	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
-	json "github.com/json-iterator/go"
 	"github.com/x-mod/errors"
 )
 
-var types = map[string]string{
-	"html":       "text/html",
-	"json":       "application/json",
-	"pb":         "application/octet-stream",
-	"pbjson":     "application/json",
-	"xml":        "application/xml",
-	"text":       "text/plain",
-	"binary":     "application/octet-stream",
-	"urlencoded": "application/x-www-form-urlencoded",
-	"form":       "application/x-www-form-urlencoded",
-	"form-data":  "application/x-www-form-urlencoded",
-	"multipart":  "multipart/form-data",
+//raw body kinds, not marshalled by a codec
+var rawTypes = map[string]string{
+	"text":   "text/plain",
+	"binary": "application/octet-stream",
+	"form":   "application/x-www-form-urlencoded",
+	"reader": "text/html",
 }
 
 //Body struct
 type Body struct {
 	config *bodyConfig
+	codecs *CodecRegistry
 }
 
 //BodyOpt type
@@ -53,36 +46,68 @@ func Binary(bytes []byte) BodyOpt {
 
 //JSON opt
 func JSON(obj interface{}) BodyOpt {
-	return func(cf *bodyConfig) {
-		cf.bodyType = "json"
-		cf.bodyObject = obj
-	}
+	return Encode("json", obj)
 }
 
 //PB opt
 func PB(obj proto.Message) BodyOpt {
 	return func(cf *bodyConfig) {
-		cf.bodyType = "pb"
-		cf.bodyObject = obj
+		if nilMessage(obj) {
+			cf.errs = append(cf.errs, errors.Errorf("%w: pb message required", ErrInvalidBody))
+			return
+		}
+		Encode("pb", obj)(cf)
 	}
 }
 
+//nilMessage the message is nil or a typed nil pointer
+func nilMessage(obj proto.Message) bool {
+	if obj == nil {
+		return true
+	}
+	v := reflect.ValueOf(obj)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
 //PBJSON opt
 func PBJSON(obj proto.Message) BodyOpt {
 	return func(cf *bodyConfig) {
-		cf.bodyType = "pbjson"
-		cf.bodyObject = obj
+		if nilMessage(obj) {
+			cf.errs = append(cf.errs, errors.Errorf("%w: pbjson message required", ErrInvalidBody))
+			return
+		}
+		Encode("pbjson", obj)(cf)
 	}
 }
 
 //XML opt
 func XML(obj interface{}) BodyOpt {
+	return Encode("xml", obj)
+}
+
+//Encode opt, marshal the obj by the codec registered with the name
+func Encode(codecName string, obj interface{}) BodyOpt {
 	return func(cf *bodyConfig) {
-		cf.bodyType = "xml"
+		cf.bodyType = strings.ToLower(codecName)
 		cf.bodyObject = obj
 	}
 }
 
+//MsgPack opt, application/msgpack
+func MsgPack(obj interface{}) BodyOpt {
+	return Encode("msgpack", obj)
+}
+
+//CBOR opt, application/cbor (RFC 8949)
+func CBOR(obj interface{}) BodyOpt {
+	return Encode("cbor", obj)
+}
+
+//YAML opt, application/yaml (RFC 9512)
+func YAML(obj interface{}) BodyOpt {
+	return Encode("yaml", obj)
+}
+
 //Form opt
 func Form(obj url.Values) BodyOpt {
 	return func(cf *bodyConfig) {
@@ -94,50 +119,57 @@ func Form(obj url.Values) BodyOpt {
 //Reader opt
 func Reader(rd io.Reader) BodyOpt {
 	return func(cf *bodyConfig) {
+		if rd == nil {
+			cf.errs = append(cf.errs, errors.Errorf("%w: reader required", ErrInvalidBody))
+			return
+		}
 		cf.bodyType = "reader"
 		cf.bodyObject = rd
 	}
 }
 
+//ContentType opt, override the Content-Type of the body kind, eg. multipart/form-data with the boundary
+func ContentType(contentType string) BodyOpt {
+	return func(cf *bodyConfig) {
+		cf.contentType = contentType
+	}
+}
+
 //Get Body io.Reader
 func (b *Body) Get() (io.Reader, error) {
 	if b.config != nil {
-		switch strings.ToLower(b.config.bodyType) {
+		obj := b.config.bodyObject
+		switch b.config.bodyType {
+		case "":
+			return bytes.NewBuffer([]byte{}), nil
 		case "text":
-			return bytes.NewBufferString(b.config.bodyObject.(string)), nil
+			if txt, ok := obj.(string); ok {
+				return bytes.NewBufferString(txt), nil
+			}
 		case "binary":
-			return bytes.NewBuffer(b.config.bodyObject.([]byte)), nil
-		case "json":
-			byts, err := json.Marshal(b.config.bodyObject)
-			if err != nil {
-				return nil, errors.Annotate(err, "json marshal failed")
+			if byts, ok := obj.([]byte); ok {
+				return bytes.NewBuffer(byts), nil
 			}
-			return bytes.NewBuffer(byts), nil
-		case "pb":
-			byts, err := proto.Marshal(b.config.bodyObject.(proto.Message))
-			if err != nil {
-				return nil, errors.Annotate(err, "pb marshal failed")
+		case "form":
+			if values, ok := obj.(url.Values); ok {
+				return strings.NewReader(values.Encode()), nil
 			}
-			return bytes.NewBuffer(byts), nil
-		case "pbjson":
-			wr := bytes.NewBuffer([]byte{})
-			marshaler := &jsonpb.Marshaler{EmitDefaults: true}
-			if err := marshaler.Marshal(wr, b.config.bodyObject.(proto.Message)); err != nil {
-				return nil, errors.Annotate(err, "pbjson marshal failed")
+		case "reader":
+			if rd, ok := obj.(io.Reader); ok {
+				return rd, nil
+			}
+		default:
+			codec, ok := b.registry().Get(b.config.bodyType)
+			if !ok {
+				return nil, errors.Errorf("%w: codec %q not registered", ErrInvalidBody, b.config.bodyType)
 			}
-			return wr, nil
-		case "xml":
-			byts, err := xml.Marshal(b.config.bodyObject)
+			byts, err := codec.Marshal(obj)
 			if err != nil {
-				return nil, errors.Annotate(err, "xml marshal failed")
+				return nil, errors.Errorf("%w: %s marshal failed: %v", ErrInvalidBody, b.config.bodyType, err)
 			}
 			return bytes.NewBuffer(byts), nil
-		case "form":
-			data := b.config.bodyObject.(url.Values).Encode()
-			return strings.NewReader(data), nil
-		case "reader":
-			return b.config.bodyObject.(io.Reader), nil
 		}
+		return nil, errors.Errorf("%w: %s body with %T content", ErrInvalidBody, b.config.bodyType, obj)
 	}
 	return bytes.NewBuffer([]byte{}), nil
 }
@@ -145,9 +177,22 @@ func (b *Body) Get() (io.Reader, error) {
 //ContentType Body Content-Type
 func (b *Body) ContentType() string {
 	if b.config != nil {
-		if v, ok := types[strings.ToLower(b.config.bodyType)]; ok {
+		if len(b.config.contentType) > 0 {
+			return b.config.contentType
+		}
+		if v, ok := rawTypes[b.config.bodyType]; ok {
 			return v
 		}
+		if codec, ok := b.registry().Get(b.config.bodyType); ok {
+			return codec.ContentType()
+		}
+	}
+	return "text/html"
+}
+
+func (b *Body) registry() *CodecRegistry {
+	if b.codecs != nil {
+		return b.codecs
 	}
-	return types["html"]
+	return DefaultCodecs
 }
@@ -8,7 +8,6 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"time"
 
 	"github.com/x-mod/errors"
@@ -19,7 +18,7 @@ var (
 	DefaultMaxConnsPerHost = 32
 	//DefaultMaxIdleConnsPerHost default max idle connections for per host
 	DefaultMaxIdleConnsPerHost = 8
-	//DefaultClientTimeout default client timeout for each do request
+	//DefaultClientTimeout default client timeout for each attempt
 	DefaultClientTimeout = 30 * time.Second
 	//DefaultTLSHandhakeTimeout default client tls hands hake timeout
 	DefaultTLSHandhakeTimeout = 10 * time.Second
@@ -37,7 +36,7 @@ type Client struct {
 //Opt for client
 type Opt func(*config)
 
-//Timeout opt
+//Timeout opt, deadline of each attempt when neither the Timeouts nor the RequestTimeouts are set
 func Timeout(duration time.Duration) Opt {
 	return func(cf *config) {
 		cf.timeout = duration
@@ -60,7 +59,7 @@ func Retry(retry int) Opt {
 	}
 }
 
-//ExecuteRetry opt for client.Execute, only > 1
+//ExecuteRetry opt for client.Execute & the method helpers Get/Post/Put/Delete, only > 1
 func ExecuteRetry(retry int) Opt {
 	return func(cf *config) {
 		if retry > 1 {
@@ -76,13 +75,6 @@ func TLSConfig(cred *tls.Config) Opt {
 	}
 }
 
-//Proxy opt
-func Proxy(host string) Opt {
-	return func(cf *config) {
-		cf.proxy = host
-	}
-}
-
 //DialContext dialer function
 type DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
 
@@ -142,6 +134,35 @@ func HTTPClient(client *http.Client) Opt {
 	}
 }
 
+//BaseURL opt, relative request URLs are resolved against it (RFC 3986)
+func BaseURL(base string) Opt {
+	return func(cf *config) {
+		cf.baseURL = base
+	}
+}
+
+//DefaultRequestOpts opt, applied to every request made by Client.MakeRequest before the request's own options
+func DefaultRequestOpts(opts ...ReqOpt) Opt {
+	return func(cf *config) {
+		cf.requestOpts = append(cf.requestOpts, opts...)
+	}
+}
+
+//RegisterCodec opt, register a body codec on the client, override the codec of the same name (eg. json)
+func RegisterCodec(name string, codec Codec, mediaTypes ...string) Opt {
+	return func(cf *config) {
+		cf.codecs.Register(name, codec, mediaTypes...)
+	}
+}
+
+//ProblemDetails opt, Execute returns a *ProblemError for a non-2xx application/problem+json response (RFC 9457)
+//instead of handing it to the processor
+func ProblemDetails(flag bool) Opt {
+	return func(cf *config) {
+		cf.problems = flag
+	}
+}
+
 //New client
 func New(opts ...Opt) *Client {
 	cf := &config{
@@ -151,6 +172,8 @@ func New(opts ...Opt) *Client {
 		maxConnsPerHost:     DefaultMaxConnsPerHost,
 		maxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
 		tlsHandsHakeTimeout: DefaultTLSHandhakeTimeout,
+		codecs:              DefaultCodecs.clone(),
+		eventReconnects:     DefaultEventReconnects,
 	}
 	for _, opt := range opts {
 		opt(cf)
@@ -164,9 +187,14 @@ func getClient(cf *config) *http.Client {
 	if cf.client != nil {
 		return cf.client
 	}
+	//the connect timeout, the client timeout by default
+	dialTimeout := cf.timeout
+	if tc := newTimeoutConfig(cf.timeoutOpts); tc.connect > 0 {
+		dialTimeout = tc.connect
+	}
 	tr := &http.Transport{
 		DialContext: (&net.Dialer{
-			Timeout:   cf.timeout,   //must less then config.timeout
+			Timeout:   dialTimeout, //must less then config.timeout
 			KeepAlive: cf.keepalive, //zero, keep-alives are enabled
 			DualStack: true,
 		}).DialContext,
@@ -178,17 +206,46 @@ func getClient(cf *config) *http.Client {
 	if cf.dialer != nil {
 		tr.DialContext = cf.dialer
 	}
-	if len(cf.proxy) > 0 {
-		if u, err := url.Parse(cf.proxy); err == nil {
-			tr.Proxy = http.ProxyURL(u)
+	dial := tr.DialContext
+	tr.DialContext = cf.targets.dialer(tr.DialContext)
+	if cf.transport == nil {
+		//the environment by default
+		if cf.proxies == nil {
+			cf.proxies = newProxyConfig()
 		}
+		cf.proxies.bypass = cf.targets.match
+		cf.proxies.transport(tr)
 	}
+	//the deadlines by the context, not to cut off the longer request & phase timeouts
 	client := &http.Client{
 		Transport: tr,
-		Timeout:   cf.timeout,
+	}
+	if cf.targets != nil {
+		client.CheckRedirect = cf.targets.checkRedirect
 	}
 	if cf.transport != nil {
 		client.Transport = cf.transport
+	} else {
+		if cf.tlsReloader != nil {
+			tr.TLSClientConfig = cf.tlsReloader.config(tr.TLSClientConfig)
+			if cf.tlsReloader.verifying {
+				tr.DialTLSContext = cf.tlsReloader.dialTLS(tr)
+			}
+			cf.tlsReloader.start()
+		}
+		if cf.pins != nil {
+			if cf.tlsReloader != nil && cf.tlsReloader.verifying {
+				cf.pins.roots = cf.tlsReloader.currentRoots
+			}
+			tr.TLSClientConfig = cf.pins.config(tr.TLSClientConfig)
+		}
+		cf.sockets = &socketTransports{base: tr, dial: dial, transports: make(map[string]*http.Transport)}
+		if cf.proxies != nil && cf.proxies.pac != nil {
+			//the script is fetched directly, with the client's tls config & dialer
+			fetch := tr.Clone()
+			fetch.Proxy, fetch.OnProxyConnectResponse = nil, nil
+			cf.proxies.pac.client.Transport = fetch
+		}
 	}
 	return client
 }
@@ -198,16 +255,86 @@ func (c *Client) GetTransport() http.RoundTripper {
 	return c.Client.Transport
 }
 
+//Codecs registry of the client
+func (c *Client) Codecs() *CodecRegistry {
+	return c.config.codecs
+}
+
 //GetClient get standard http.Client
 func (c *Client) GetClient() *http.Client {
 	return c.Client
 }
 
+//MakeRequest make a http.Request with the client's base url & default request options
+func (c *Client) MakeRequest(opts ...ReqOpt) (*http.Request, error) {
+	return c.newRequestConfig(opts).makeRequest()
+}
+
+func (c *Client) newRequestConfig(opts []ReqOpt) *requestConfig {
+	cf := newRequestConfig(c.config.requestOpts, opts)
+	cf.codecs = c.config.codecs
+	if len(c.config.baseURL) > 0 {
+		base, socket, err := parseURL(c.config.baseURL)
+		if err != nil {
+			cf.errs = append(cf.errs, errors.Errorf("%w: base url: %v", ErrInvalidURL, err))
+		} else if cf.URL == nil {
+			cf.URL, cf.options.socket = base, socket
+		} else if !cf.URL.IsAbs() {
+			cf.URL, cf.options.socket = base.ResolveReference(cf.URL), socket
+		}
+	}
+	return cf
+}
+
+//Get make & do a GET request like Execute, the path is resolved against the base url, the caller should close the response body
+func (c *Client) Get(ctx context.Context, path string, opts ...ReqOpt) (*http.Response, error) {
+	return c.request(ctx, http.MethodGet, path, opts...)
+}
+
+//Post make & do a POST request, the path is resolved against the base url, the caller should close the response body
+func (c *Client) Post(ctx context.Context, path string, opts ...ReqOpt) (*http.Response, error) {
+	return c.request(ctx, http.MethodPost, path, opts...)
+}
+
+//Put make & do a PUT request, the path is resolved against the base url, the caller should close the response body
+func (c *Client) Put(ctx context.Context, path string, opts ...ReqOpt) (*http.Response, error) {
+	return c.request(ctx, http.MethodPut, path, opts...)
+}
+
+//Delete make & do a DELETE request, the path is resolved against the base url, the caller should close the response body
+func (c *Client) Delete(ctx context.Context, path string, opts ...ReqOpt) (*http.Response, error) {
+	return c.request(ctx, http.MethodDelete, path, opts...)
+}
+
+func (c *Client) request(ctx context.Context, method string, path string, opts ...ReqOpt) (*http.Response, error) {
+	req, err := c.MakeRequest(append([]ReqOpt{Method(method), SetURL(path)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return c.execute(ctx, req)
+}
+
 //Execute client
 func (c *Client) Execute(ctx context.Context, req *http.Request, processor ResponseProcessor) error {
 	if req == nil {
 		return errors.New("request required")
 	}
+	rsp, err := c.execute(ctx, req)
+	if err != nil {
+		return err
+	}
+	//the body is always drained & closed, so the connection returns to the pool
+	defer drainBody(rsp.Body)
+	if c.config.problems && isProblem(rsp) {
+		return decodeProblem(rsp)
+	}
+	if processor != nil {
+		return processor.Process(withCodecs(ctx, c.config.codecs), rsp)
+	}
+	return nil
+}
+
+func (c *Client) execute(ctx context.Context, req *http.Request) (*http.Response, error) {
 	if c.config.debug {
 		if b, err := httputil.DumpRequest(req, true); err == nil {
 			fmt.Println("------------------------------")
@@ -215,9 +342,25 @@ func (c *Client) Execute(ctx context.Context, req *http.Request, processor Respo
 			fmt.Println("------------------------------")
 		}
 	}
-	rsp, err := c.DoRequest(ctx, req)
+	var rsp *http.Response
+	var err error
+	//retries for execute
+	for i := 0; i < c.config.executeRetries; i++ {
+		r := req
+		if i > 0 {
+			if !replayable(req) {
+				break
+			}
+			if r, err = rewind(req); err != nil {
+				return nil, err
+			}
+		}
+		if rsp, err = c.DoRequest(ctx, r); err == nil || ctx.Err() != nil {
+			break
+		}
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if c.config.debug {
 		if b, err := httputil.DumpResponse(rsp, true); err == nil {
@@ -225,23 +368,40 @@ func (c *Client) Execute(ctx context.Context, req *http.Request, processor Respo
 			fmt.Println("------------------------------")
 		}
 	}
-
-	if processor != nil {
-		return processor.Process(ctx, rsp)
-	}
-	return nil
+	return rsp, nil
 }
 
-//DoRequest do request with context
+//DoRequest do request with context, the settings of the request made by MakeRequest are kept
 func (c *Client) DoRequest(ctx context.Context, req *http.Request) (resp *http.Response, err error) {
+	if options := requestOptionsFrom(req.Context()); options != nil {
+		ctx = withRequestOptions(ctx, options)
+	}
 	return c.Do(req.WithContext(ctx))
 }
 
-//Do reimpl
+//Do reimpl, retries within the request timeout, each attempt within the phase timeouts
 func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
+	tc := c.timeouts(req)
+	if tc.request <= 0 {
+		return c.retry(req.Context(), req, tc)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), tc.request)
+	if resp, err = c.retry(ctx, req, tc); err != nil {
+		cancel()
+		return nil, requestTimeoutError(req.Context(), ctx, tc.request, err)
+	}
+	resp.Body = &requestBody{ReadCloser: resp.Body, ctx: req.Context(), rctx: ctx, timeout: tc.request, cancel: cancel}
+	return resp, nil
+}
+
+func (c *Client) retry(ctx context.Context, req *http.Request, tc timeoutConfig) (resp *http.Response, err error) {
 	//retries for do
 	for i := 0; i < c.config.doRetries; i++ {
-		if resp, err = c.Client.Do(req); err == nil {
+		if resp, err = c.send(ctx, req, tc); err == nil {
+			return
+		}
+		//the context is done, or the consumed body can't be sent again
+		if ctx.Err() != nil || !replayable(req) {
 			return
 		}
 	}
@@ -5,4 +5,7 @@ package httpclient
 //Close Client release connection resource
 func (c *Client) Close() {
 	c.Client.CloseIdleConnections()
+	if c.config.tlsReloader != nil {
+		c.config.tlsReloader.close()
+	}
 }
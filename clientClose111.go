@@ -3,4 +3,8 @@
 package httpclient
 
 //Close Client release connection resource
-func (c *Client) Close() {}
+func (c *Client) Close() {
+	if c.config.tlsReloader != nil {
+		c.config.tlsReloader.close()
+	}
+}
@@ -1,14 +1,26 @@
 package httpclient
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -143,3 +155,559 @@ func TestClient_Execute(t *testing.T) {
 	assert.NotNil(t, dump)
 	assert.Nil(t, dump.Process(context.TODO(), rsp))
 }
+
+func TestClient_BaseURL(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "jay" || pass != "123" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, "%s %s %s %s", r.Method, r.URL.RequestURI(), r.Header.Get("X-Env"), r.Header.Get("X-Trace"))
+		}),
+	)
+	defer ts.Close()
+
+	client := New(
+		BaseURL(ts.URL+"/api/v1/"),
+		DefaultRequestOpts(
+			BasicAuth("jay", "123"),
+			Header("X-Env", "test"),
+			Header("X-Trace", "default"),
+		),
+	)
+
+	req, err := client.MakeRequest(URL(URI("users")), Query("page", "2"))
+	assert.Nil(t, err)
+	assert.Equal(t, ts.URL+"/api/v1/users?page=2", req.URL.String())
+
+	req, err = client.MakeRequest(URL(URI("/health")))
+	assert.Nil(t, err)
+	assert.Equal(t, ts.URL+"/health", req.URL.String())
+
+	req, err = client.MakeRequest(SetURL("http://other.host/x"))
+	assert.Nil(t, err)
+	assert.Equal(t, "http://other.host/x", req.URL.String())
+
+	rsp, err := client.Get(context.TODO(), "users/1", Header("X-Trace", "override"))
+	assert.Nil(t, err)
+	defer rsp.Body.Close()
+	b, _ := ioutil.ReadAll(rsp.Body)
+	assert.Equal(t, "GET /api/v1/users/1 test override", string(b))
+
+	rsp, err = client.Delete(context.TODO(), "users/1")
+	assert.Nil(t, err)
+	defer rsp.Body.Close()
+	b, _ = ioutil.ReadAll(rsp.Body)
+	assert.Equal(t, "DELETE /api/v1/users/1 test default", string(b))
+
+	rsp, err = client.Post(context.TODO(), "users", BasicAuth("jay", "bad"))
+	assert.Nil(t, err)
+	defer rsp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+
+	//the helpers retry like Execute
+	requests := 0
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer flaky.Close()
+	rsp, err = New(BaseURL(flaky.URL), ExecuteRetry(2)).Get(context.TODO(), "/")
+	if assert.Nil(t, err) {
+		defer rsp.Body.Close()
+		assert.Equal(t, 2, requests)
+	}
+
+	//the body is sent again by the retries of Do
+	bodies, fails := make(chan string, 4), make(chan bool, 2)
+	flaky = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(b)
+		select {
+		case <-fails:
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		default:
+			io.WriteString(w, "ok")
+		}
+	}))
+	defer flaky.Close()
+	client = New(Retry(2))
+	req, err = MakeRequest(Method(http.MethodPost), SetURL(flaky.URL), Content(Text("hello")))
+	assert.Nil(t, err)
+	fails <- true
+	rsp, err = client.Do(req)
+	if assert.Nil(t, err) {
+		defer rsp.Body.Close()
+		assert.Equal(t, 2, len(bodies))
+		assert.Equal(t, "hello", <-bodies)
+		assert.Equal(t, "hello", <-bodies)
+	}
+	//not replayable, sent once
+	req, _ = http.NewRequest(http.MethodPost, flaky.URL, ioutil.NopCloser(strings.NewReader("hello")))
+	fails <- true
+	_, err = client.Do(req)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(bodies))
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	connects := 0
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			connects++
+			if user, _, ok := r.BasicAuth(); !ok || user != "jay" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			switch r.Header.Get("Last-Event-ID") {
+			case "":
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, "\ufeff: comment\r\nretry: 10\r\nid: 1\r\ndata: hello\r\ndata: world\r\n\r\n")
+				w.(http.Flusher).Flush()
+				//longer than the client's Timeout
+				time.Sleep(100 * time.Millisecond)
+				io.WriteString(w, "event: ping\rdata\r\rid: 2\ndata: {\"a\":1}\n\nid: 3\n")
+			case "3":
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				http.Error(w, "unexpected", http.StatusBadRequest)
+			}
+		}),
+	)
+	defer ts.Close()
+
+	client := New(BaseURL(ts.URL), Timeout(50*time.Millisecond), EventBackoff(ConstantBackoff(time.Millisecond)),
+		DefaultRequestOpts(BasicAuth("jay", "123")))
+	events := []*Event{}
+	err := client.Subscribe(context.TODO(), func(ctx context.Context, event *Event) error {
+		events = append(events, event)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, connects)
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, &Event{ID: "1", Event: "message", Data: "hello\nworld", Retry: 10 * time.Millisecond}, events[0])
+		assert.Equal(t, &Event{ID: "1", Event: "ping", Data: ""}, events[1])
+		assert.Equal(t, &Event{ID: "2", Event: "message", Data: `{"a":1}`}, events[2])
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	ch, errs := client.Events(ctx)
+	<-ch
+	cancel()
+	for range ch {
+	}
+	assert.Equal(t, context.Canceled, <-errs)
+
+	//the network errors after the reconnects
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	ln.Close()
+	client = New(BaseURL("http://"+ln.Addr().String()), EventReconnects(0))
+	err = client.Subscribe(context.TODO(), func(ctx context.Context, event *Event) error {
+		return nil
+	})
+	oe := &net.OpError{}
+	assert.True(t, errors.As(err, &oe))
+
+	//a line too long isn't reconnected
+	connects = 0
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connects++
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: "+strings.Repeat("a", 8192)+"\n\n")
+	}))
+	defer ts.Close()
+	size := DefaultMaxLineSize
+	DefaultMaxLineSize = 4096
+	err = New(BaseURL(ts.URL), EventBackoff(ConstantBackoff(time.Millisecond))).Subscribe(context.TODO(), func(ctx context.Context, event *Event) error {
+		return nil
+	})
+	DefaultMaxLineSize = size
+	assert.Equal(t, bufio.ErrTooLong, err)
+	assert.Equal(t, 1, connects)
+}
+
+func TestClient_Paginate(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Token") != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			q := r.URL.Query()
+			n := func(name string, def int) int {
+				if v, err := strconv.Atoi(q.Get(name)); err == nil {
+					return v
+				}
+				return def
+			}
+			slice := func(from, to int) []int {
+				if from > len(items) {
+					from = len(items)
+				}
+				if to > len(items) {
+					to = len(items)
+				}
+				return items[from:to]
+			}
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/link":
+				page := n("p", 0)
+				if (page+1)*2 < len(items) {
+					w.Header().Add("Link", fmt.Sprintf(`</link?p=%d>; rel="next last", <http://other>; rel=prev`, page+1))
+				}
+				json.NewEncoder(w).Encode(slice(page*2, page*2+2))
+			case "/cursor":
+				c := n("cursor", 0)
+				next := ""
+				if c+2 < len(items) {
+					next = strconv.Itoa(c + 2)
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": slice(c, c+2), "meta": map[string]string{"next": next}})
+			case "/page":
+				page := n("page", -1)
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": slice((page-1)*2, page*2)})
+			case "/offset":
+				offset, limit := n("offset", -1), n("limit", -1)
+				json.NewEncoder(w).Encode(slice(offset, offset+limit))
+			}
+		}),
+	)
+	defer ts.Close()
+
+	client := New(BaseURL(ts.URL))
+	builder := NewRequestBuilder(Header("X-Token", "secret"))
+	paginate := func(path string, pagination Pagination, opts ...PaginateOpt) ([]int, error) {
+		all := []int{}
+		err := client.Paginate(context.TODO(), builder.With(SetURL(path)), pagination, ResponseProcessorFunc(func(ctx context.Context, rsp *http.Response) error {
+			b, _ := ioutil.ReadAll(rsp.Body)
+			page := []int{}
+			if err := json.Unmarshal(b, &page); err != nil {
+				var wrapped struct{ Data []int }
+				if err := json.Unmarshal(b, &wrapped); err != nil {
+					return err
+				}
+				page = wrapped.Data
+			}
+			all = append(all, page...)
+			return nil
+		}), opts...)
+		return all, err
+	}
+
+	tests := []struct {
+		path       string
+		pagination Pagination
+		opts       []PaginateOpt
+		want       []int
+	}{
+		{"/link", LinkPagination(), nil, items},
+		{"/cursor", CursorPagination("meta.next", "cursor"), nil, items},
+		{"/page", PagePagination("page", 1, "data"), nil, items},
+		{"/offset", OffsetPagination("offset", "limit", 2, ""), nil, items},
+		{"/offset", OffsetPagination("offset", "limit", 2, ""), []PaginateOpt{MaxPages(2)}, items[:4]},
+	}
+	for _, tt := range tests {
+		got, err := paginate(tt.path, tt.pagination, tt.opts...)
+		assert.Nil(t, err, tt.path)
+		assert.Equal(t, tt.want, got, tt.path)
+	}
+	assert.Len(t, builder.Options(), 1)
+}
+
+func TestClient_DialWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{"chat"}, EnableCompression: true}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if c, err := r.Cookie("session"); err != nil || c.Value != "s1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, b, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(mt, b)
+		}
+	}))
+	defer ts.Close()
+
+	client := New(BaseURL(ts.URL), DefaultRequestOpts(Header("X-Token", "secret")))
+	_, err := client.DialWebSocket(context.TODO(), SetURL("/ws"))
+	serr, ok := err.(*StatusError)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, http.StatusForbidden, serr.StatusCode)
+	}
+
+	ws, err := client.DialWebSocket(context.TODO(), SetURL("/ws"),
+		Cookie(&http.Cookie{Name: "session", Value: "s1"}),
+		Subprotocols("chat", "superchat"),
+		PerMessageDeflate(true),
+		PingInterval(50*time.Millisecond),
+	)
+	assert.Nil(t, err)
+	if err != nil {
+		return
+	}
+	assert.Equal(t, "chat", ws.Subprotocol())
+	assert.Nil(t, ws.WriteMessage(TextMessage, []byte("hello")))
+	//the keepalive only expires while reading
+	time.Sleep(150 * time.Millisecond)
+	mt, b, err := ws.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, TextMessage, mt)
+	assert.Equal(t, "hello", string(b))
+	assert.Nil(t, ws.Close())
+	assert.NotNil(t, ws.Close())
+	_, _, err = ws.ReadMessage()
+	assert.NotNil(t, err)
+
+	//closed while reading, the reader receives the peer's close frame
+	ws, err = client.DialWebSocket(context.TODO(), SetURL("/ws"), Cookie(&http.Cookie{Name: "session", Value: "s1"}))
+	assert.Nil(t, err)
+	if err != nil {
+		return
+	}
+	read := make(chan error)
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				read <- err
+				return
+			}
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(t, ws.Close())
+	assert.True(t, websocket.IsCloseError(<-read, websocket.CloseNormalClosure))
+}
+
+func TestClient_ReadLimits(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		switch r.URL.Path {
+		case "/big":
+			w.Write(make([]byte, 1024))
+		case "/stall":
+			w.Write([]byte("a"))
+			flusher.Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		case "/trickle":
+			for i := 0; i < 20; i++ {
+				w.Write([]byte("a"))
+				flusher.Flush()
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+		}
+	}))
+	defer ts.Close()
+
+	client := New(BaseURL(ts.URL), ReadLimits(MaxBodySize(100)))
+	execute := func(path string, opts ...ReqOpt) error {
+		req, err := client.MakeRequest(append([]ReqOpt{SetURL(path)}, opts...)...)
+		if err != nil {
+			return err
+		}
+		return client.Execute(context.TODO(), req, Capture(&Captured{}))
+	}
+	err := execute("/big")
+	assert.True(t, errors.Is(err, ErrBodyTooLarge))
+	tooLarge := &BodyTooLargeError{}
+	if assert.True(t, errors.As(err, &tooLarge)) {
+		assert.Equal(t, int64(100), tooLarge.Limit)
+	}
+	assert.Nil(t, execute("/big", RequestReadLimits(MaxBodySize(0))))
+
+	start := time.Now()
+	assert.True(t, errors.Is(execute("/stall", RequestReadLimits(ReadIdleTimeout(50*time.Millisecond))), ErrReadIdle))
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	assert.True(t, errors.Is(execute("/trickle", RequestReadLimits(MinReadRate(1000, 100*time.Millisecond))), ErrReadTooSlow))
+	assert.Nil(t, execute("/trickle", RequestReadLimits(ReadIdleTimeout(200*time.Millisecond))))
+}
+
+//slowReader returns the data after the delay, even when closed meanwhile
+type slowReader struct {
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return copy(p, "a"), nil
+}
+
+func (r *slowReader) Close() error {
+	return nil
+}
+
+func TestGuardedBody(t *testing.T) {
+	fast := &guardedBody{ReadCloser: ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 1024))), config: readConfig{idleTimeout: time.Second}}
+	b := make([]byte, 1)
+	fast.Read(b)
+	assert.Equal(t, float64(0), testing.AllocsPerRun(100, func() {
+		fast.Read(b)
+	}))
+
+	//the read completed after the watchdog keeps its data, the next one fails
+	slow := &guardedBody{ReadCloser: &slowReader{delay: 50 * time.Millisecond}, config: readConfig{idleTimeout: 10 * time.Millisecond}}
+	n, err := slow.Read(b)
+	assert.Equal(t, 1, n)
+	assert.Nil(t, err)
+	_, err = slow.Read(b)
+	assert.True(t, errors.Is(err, ErrReadIdle))
+}
+
+func TestClient_Timeouts(t *testing.T) {
+	wait := func(r *http.Request, d time.Duration) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(d):
+		}
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-header":
+			wait(r, 300*time.Millisecond)
+		case "/slow-body":
+			w.Write([]byte("a"))
+			w.(http.Flusher).Flush()
+			wait(r, 300*time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := New(BaseURL(ts.URL), Retry(5))
+	execute := func(path string, opts ...ReqOpt) error {
+		req, err := client.MakeRequest(append([]ReqOpt{SetURL(path)}, opts...)...)
+		if err != nil {
+			return err
+		}
+		return client.Execute(context.TODO(), req, Capture(&Captured{}))
+	}
+	phase := func(err error) string {
+		terr := &TimeoutError{}
+		if errors.As(err, &terr) {
+			assert.True(t, errors.Is(err, context.DeadlineExceeded))
+			return terr.Phase
+		}
+		return ""
+	}
+	assert.Nil(t, execute("/", RequestTimeout(time.Second), RequestTimeouts(ResponseHeaderTimeout(time.Second))))
+	assert.Equal(t, PhaseResponseHeader, phase(execute("/slow-header", RequestTimeouts(ResponseHeaderTimeout(50*time.Millisecond)))))
+	assert.Equal(t, PhaseBodyRead, phase(execute("/slow-body", RequestTimeouts(BodyReadTimeout(50*time.Millisecond)))))
+	assert.Equal(t, PhaseAttempt, phase(execute("/slow-header", RequestTimeouts(AttemptTimeout(20*time.Millisecond)))))
+
+	start := time.Now()
+	err := execute("/slow-header", RequestTimeout(100*time.Millisecond), RequestTimeouts(AttemptTimeout(40*time.Millisecond)))
+	assert.Equal(t, PhaseRequest, phase(err))
+	assert.True(t, time.Since(start) < 250*time.Millisecond)
+
+	//the client's Timeout is the attempt deadline, not capping the longer request timeouts
+	client = New(BaseURL(ts.URL), Timeout(100*time.Millisecond))
+	assert.Equal(t, PhaseAttempt, phase(execute("/slow-header")))
+	assert.Nil(t, execute("/slow-header", RequestTimeout(time.Second)))
+	assert.Nil(t, execute("/slow-body", RequestTimeouts(BodyReadTimeout(time.Second))))
+}
+
+func TestClient_DialTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpclient")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "api.sock")
+	ln, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, "http://127.0.0.1:1/", http.StatusFound)
+			return
+		}
+		w.Write([]byte(r.Host + " " + r.URL.RequestURI()))
+	}))
+	ts.Listener.Close()
+	ts.Listener = ln
+	ts.Start()
+	defer ts.Close()
+
+	get := func(client *Client, u string) (string, error) {
+		captured := &Captured{}
+		req, err := client.MakeRequest(SetURL(u))
+		if err != nil {
+			return "", err
+		}
+		err = client.Execute(context.TODO(), req, Capture(captured))
+		return string(captured.Body), err
+	}
+	client := New(Proxy("http://127.0.0.1:1"))
+	body, err := get(client, "unix://"+socket+":/v1/info?all=1")
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost /v1/info?all=1", body)
+	body, err = get(client, "http+unix://"+url.PathEscape(socket)+"/v1/version")
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost /v1/version", body)
+	body, err = get(New(BaseURL("unix://"+socket)), "/containers/json")
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost /containers/json", body)
+	//the redirects stay in the socket
+	_, err = get(client, "unix://"+socket+":/away")
+	assert.NotNil(t, err)
+	//a plain localhost url isn't the socket
+	_, err = get(New(), "http://localhost:1/v1/info")
+	assert.NotNil(t, err)
+
+	//logical hosts
+	tls := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/into" {
+			http.Redirect(w, r, "http://sidecar:8080/health", http.StatusFound)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+		w.Write([]byte(r.Host + " " + r.TLS.ServerName))
+	}))
+	defer tls.Close()
+	jar, _ := cookiejar.New(nil)
+	tr := tls.Client().Transport.(*http.Transport)
+	client = New(
+		TLSConfig(tr.TLSClientConfig),
+		DialTarget("example.com:443", tls.Listener.Addr().String()),
+		DialTarget("sidecar", "unix://"+socket),
+	)
+	client.GetClient().Jar = jar
+	body, err = get(client, "https://example.com/")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com example.com", body)
+	assert.Len(t, jar.Cookies(&url.URL{Scheme: "https", Host: "example.com"}), 1)
+	body, err = get(client, "http://sidecar:8080/health")
+	assert.Nil(t, err)
+	assert.Equal(t, "sidecar:8080 /health", body)
+	//no redirect into the unix socket targets
+	_, err = get(client, "https://example.com/into")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "refused")
+	}
+}
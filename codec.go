@@ -0,0 +1,222 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	json "github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/x-mod/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+//Codec interface, marshal request bodies & unmarshal response bodies
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	ContentType() string
+}
+
+//DefaultCodecs registry used by requests & processors without a client
+var DefaultCodecs = NewCodecRegistry()
+
+//CodecRegistry named codecs
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+	types  map[string]string
+}
+
+//NewCodecRegistry new registry with the built-in codecs: json, xml, pb, pbjson, msgpack, cbor, yaml
+func NewCodecRegistry() *CodecRegistry {
+	r := &CodecRegistry{
+		codecs: make(map[string]Codec),
+		types:  make(map[string]string),
+	}
+	r.Register("json", jsonCodec{})
+	r.Register("xml", xmlCodec{}, "text/xml")
+	r.Register("pb", pbCodec{}, "application/x-protobuf", "application/protobuf")
+	r.Register("pbjson", pbjsonCodec{})
+	r.Register("msgpack", msgpackCodec{}, "application/x-msgpack", "application/vnd.msgpack")
+	r.Register("cbor", cborCodec{})
+	r.Register("yaml", yamlCodec{}, "application/x-yaml", "text/yaml", "text/x-yaml")
+	return r
+}
+
+//Register a codec by name, replace the codec registered with the same name.
+//The codec's Content-Type & the extra media types are used to find the codec of a response,
+//a media type already taken by another codec is kept by the first one.
+func (r *CodecRegistry) Register(name string, codec Codec, mediaTypes ...string) {
+	name = strings.ToLower(name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs[name] = codec
+	for _, v := range append([]string{codec.ContentType()}, mediaTypes...) {
+		if mt, _, err := mime.ParseMediaType(v); err == nil {
+			if _, ok := r.types[mt]; !ok {
+				r.types[mt] = name
+			}
+		}
+	}
+}
+
+//Get codec by name
+func (r *CodecRegistry) Get(name string) (Codec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	codec, ok := r.codecs[strings.ToLower(name)]
+	return codec, ok
+}
+
+//Lookup codec by Content-Type, a structured syntax suffix (eg. application/problem+json) falls back to application/<suffix>
+func (r *CodecRegistry) Lookup(contentType string) (string, Codec, bool) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name, ok := r.types[mt]
+	if !ok {
+		if i := strings.LastIndex(mt, "+"); i > 0 {
+			name, ok = r.types["application/"+mt[i+1:]]
+		}
+	}
+	if !ok {
+		return "", nil, false
+	}
+	return name, r.codecs[name], true
+}
+
+func (r *CodecRegistry) clone() *CodecRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := &CodecRegistry{
+		codecs: make(map[string]Codec, len(r.codecs)),
+		types:  make(map[string]string, len(r.types)),
+	}
+	for k, v := range r.codecs {
+		c.codecs[k] = v
+	}
+	for k, v := range r.types {
+		c.types[k] = v
+	}
+	return c
+}
+
+type codecsKey struct{}
+
+func withCodecs(ctx context.Context, codecs *CodecRegistry) context.Context {
+	return context.WithValue(ctx, codecsKey{}, codecs)
+}
+
+//codecsFrom the client's registry carried by the context, or the DefaultCodecs
+func codecsFrom(ctx context.Context) *CodecRegistry {
+	if codecs, ok := ctx.Value(codecsKey{}).(*CodecRegistry); ok && codecs != nil {
+		return codecs
+	}
+	return DefaultCodecs
+}
+
+//CodecParams wraps the codec with Content-Type parameters, eg. charset or profile
+func CodecParams(codec Codec, params map[string]string) Codec {
+	return &paramsCodec{Codec: codec, params: params}
+}
+
+type paramsCodec struct {
+	Codec
+	params map[string]string
+}
+
+func (c *paramsCodec) ContentType() string {
+	mt, params, err := mime.ParseMediaType(c.Codec.ContentType())
+	if err != nil {
+		return c.Codec.ContentType()
+	}
+	for k, v := range c.params {
+		params[k] = v
+	}
+	return mime.FormatMediaType(mt, params)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) ContentType() string                        { return "application/json" }
+
+type xmlCodec struct{}
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error)      { return xml.Marshal(v) }
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+func (xmlCodec) ContentType() string                        { return "application/xml" }
+
+type pbCodec struct{}
+
+func (pbCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("pb codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (pbCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("pb codec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+func (pbCodec) ContentType() string { return "application/octet-stream" }
+
+type pbjsonCodec struct{}
+
+func (pbjsonCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("pbjson codec: %T is not a proto.Message", v)
+	}
+	wr := bytes.NewBuffer([]byte{})
+	marshaler := &jsonpb.Marshaler{EmitDefaults: true}
+	if err := marshaler.Marshal(wr, msg); err != nil {
+		return nil, err
+	}
+	return wr.Bytes(), nil
+}
+
+func (pbjsonCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("pbjson codec: %T is not a proto.Message", v)
+	}
+	return jsonpb.Unmarshal(bytes.NewReader(data), msg)
+}
+
+func (pbjsonCodec) ContentType() string { return "application/json" }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+func (msgpackCodec) ContentType() string                        { return "application/msgpack" }
+
+type cborCodec struct{}
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error)      { return cbor.Marshal(v) }
+func (cborCodec) Unmarshal(data []byte, v interface{}) error { return cbor.Unmarshal(data, v) }
+func (cborCodec) ContentType() string                        { return "application/cbor" }
+
+type yamlCodec struct{}
+
+func (yamlCodec) Marshal(v interface{}) ([]byte, error)      { return yaml.Marshal(v) }
+func (yamlCodec) Unmarshal(data []byte, v interface{}) error { return yaml.Unmarshal(data, v) }
+func (yamlCodec) ContentType() string                        { return "application/yaml" }
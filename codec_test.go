@@ -0,0 +1,96 @@
+package httpclient
+
+import (
+	"context"
+	stdjson "encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stdJSONCodec struct{}
+
+func (stdJSONCodec) Marshal(v interface{}) ([]byte, error)      { return stdjson.Marshal(v) }
+func (stdJSONCodec) Unmarshal(data []byte, v interface{}) error { return stdjson.Unmarshal(data, v) }
+func (stdJSONCodec) ContentType() string                        { return "application/json" }
+
+func TestCodecRegistry(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+			b, _ := ioutil.ReadAll(r.Body)
+			w.Write(b)
+		}),
+	)
+	defer ts.Close()
+
+	client := New(
+		RegisterCodec("json", CodecParams(stdJSONCodec{}, map[string]string{"charset": "utf-8"})),
+	)
+	_, ok := DefaultCodecs.Get("json")
+	assert.True(t, ok)
+
+	name, codec, ok := client.Codecs().Lookup("application/problem+json")
+	assert.True(t, ok)
+	assert.Equal(t, "json", name)
+	assert.Equal(t, "application/json; charset=utf-8", codec.ContentType())
+
+	req, err := client.MakeRequest(
+		SetURL(ts.URL),
+		Method("POST"),
+		Content(Encode("json", map[string]string{"hello": "world"})),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/json; charset=utf-8", req.Header.Get("Content-Type"))
+
+	out := map[string]string{}
+	assert.Nil(t, client.Execute(context.TODO(), req, DecodeWith("json", &out)))
+	assert.Equal(t, "world", out["hello"])
+
+	_, err = MakeRequest(SetURL(ts.URL), Method("POST"), Content(Encode("unknown", 1)))
+	assert.True(t, err != nil)
+}
+
+func TestCodec_Formats(t *testing.T) {
+	type point struct {
+		X int    `json:"x" msgpack:"x" cbor:"x" yaml:"x"`
+		Y string `json:"y" msgpack:"y" cbor:"y" yaml:"y"`
+	}
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+			b, _ := ioutil.ReadAll(r.Body)
+			w.Write(b)
+		}),
+	)
+	defer ts.Close()
+
+	client := New()
+	tests := []struct {
+		contentType string
+		body        BodyOpt
+		processor   func(interface{}, ...DecodeOpt) ResponseProcessor
+	}{
+		{"application/msgpack", MsgPack(point{1, "a"}), DecodeMsgPack},
+		{"application/cbor", CBOR(point{2, "b"}), DecodeCBOR},
+		{"application/yaml", YAML(point{3, "c"}), DecodeYAML},
+	}
+	for i, tt := range tests {
+		req, err := MakeRequest(SetURL(ts.URL), Method("PUT"), Content(tt.body))
+		assert.Nil(t, err)
+		assert.Equal(t, tt.contentType, req.Header.Get("Content-Type"))
+		out := point{}
+		assert.Nil(t, client.Execute(context.TODO(), req, tt.processor(&out)))
+		assert.Equal(t, i+1, out.X)
+	}
+
+	//the body of another codec
+	req, err := MakeRequest(SetURL(ts.URL), Method("PUT"), Content(MsgPack(point{1, "a"})))
+	assert.Nil(t, err)
+	err = client.Execute(context.TODO(), req, DecodeCBOR(&point{}))
+	assert.True(t, errors.Is(err, ErrContentTypeMismatch))
+}
@@ -8,7 +8,6 @@ import (
 )
 
 type config struct {
-	proxy               string
 	timeout             time.Duration
 	keepalive           time.Duration
 	tlsHandsHakeTimeout time.Duration
@@ -21,23 +20,30 @@ type config struct {
 	dialer              DialContext
 	transport           http.RoundTripper
 	client              *http.Client
-}
-
-type authConfig struct {
-	username string
-	password string
+	baseURL             string
+	requestOpts         []ReqOpt
+	codecs              *CodecRegistry
+	problems            bool
+	eventBackoff        BackoffFunc
+	eventReconnects     int
+	readOpts            []ReadOpt
+	timeoutOpts         []TimeoutOpt
+	auth                Authenticator
+	signer              Signer
+	tlsReloader         *tlsReloader
+	pins                *pinConfig
+	proxies             *proxyConfig
+	targets             *dialTargets
+	sockets             *socketTransports
 }
 
 type TokenFunc func() string
 
-type tokenConfig struct {
-	token    string
-	tokenGet TokenFunc
-}
-
 type bodyConfig struct {
-	bodyType   string
-	bodyObject interface{}
+	bodyType    string
+	bodyObject  interface{}
+	contentType string
+	errs        []error
 }
 
 type requestConfig struct {
@@ -46,7 +52,28 @@ type requestConfig struct {
 	Header  http.Header
 	Queries map[string]string
 	Cookies []*http.Cookie
-	Auth    *authConfig
-	Token   *tokenConfig
+	auths   []namedAuth
 	Content *Body
+	errs    []error
+	codecs  *CodecRegistry
+	//websocket options of DialWebSocket
+	websocket websocketConfig
+	options   requestOptions
+}
+
+//requestOptions the settings of the request applied by Client.Do, carried by the request's context
+type requestOptions struct {
+	read     []ReadOpt
+	timeouts []TimeoutOpt
+	auth     Authenticator
+	signer   Signer
+	//socket of the unix socket url
+	socket string
+	//stream of Subscribe, not limited by the client's Timeout
+	stream bool
+}
+
+type urlConfig struct {
+	*url.URL
+	errs []error
 }
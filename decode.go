@@ -0,0 +1,233 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/x-mod/errors"
+)
+
+var (
+	//DefaultErrorBodyLimit max bytes of a non-2xx response body read into StatusError
+	DefaultErrorBodyLimit int64 = 4 << 10
+	//DefaultDrainLimit max bytes discarded before closing a body, so the connection can be reused
+	DefaultDrainLimit int64 = 256 << 10
+)
+
+//ErrContentTypeMismatch the response Content-Type isn't of the codec of the typed decode processor
+var ErrContentTypeMismatch = errors.New("content-type mismatch")
+
+//StatusError non-2xx response error
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	//Body snippet, at most ErrorBodyLimit bytes
+	Body []byte
+}
+
+//Error implemention
+func (e *StatusError) Error() string {
+	snippet := bytes.TrimSpace(e.Body)
+	if len(snippet) > 256 {
+		snippet = append(snippet[:256:256], "..."...)
+	}
+	if len(snippet) == 0 {
+		return fmt.Sprintf("http status %s", e.Status)
+	}
+	return fmt.Sprintf("http status %s: %s", e.Status, snippet)
+}
+
+//Value implemention of errors.Code
+func (e *StatusError) Value() int32 {
+	return int32(e.StatusCode)
+}
+
+//String implemention of errors.Code
+func (e *StatusError) String() string {
+	return http.StatusText(e.StatusCode)
+}
+
+//newStatusError read at most limit bytes of the body
+func newStatusError(rsp *http.Response, limit int64) *StatusError {
+	if limit <= 0 {
+		limit = DefaultErrorBodyLimit
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, limit))
+	status := rsp.Status
+	if len(status) == 0 {
+		status = fmt.Sprintf("%d %s", rsp.StatusCode, http.StatusText(rsp.StatusCode))
+	}
+	return &StatusError{
+		StatusCode: rsp.StatusCode,
+		Status:     status,
+		Header:     rsp.Header,
+		Body:       b,
+	}
+}
+
+//responseError of a non-2xx response, *ProblemError for application/problem+json, otherwise *StatusError
+func responseError(rsp *http.Response) error {
+	if isProblem(rsp) {
+		return decodeProblem(rsp)
+	}
+	return newStatusError(rsp, DefaultErrorBodyLimit)
+}
+
+//drainBody discard the rest of the body & close it
+func drainBody(body io.ReadCloser) error {
+	if body == nil {
+		return nil
+	}
+	io.CopyN(ioutil.Discard, body, DefaultDrainLimit)
+	return body.Close()
+}
+
+func success(rsp *http.Response) bool {
+	return rsp.StatusCode >= 200 && rsp.StatusCode <= 299
+}
+
+type decodeProcessor struct {
+	codecName string
+	strict    bool
+	obj       interface{}
+	errObj    interface{}
+	limit     int64
+}
+
+//DecodeOpt option of the decode processors
+type DecodeOpt func(*decodeProcessor)
+
+//ErrorInto decode the non-2xx response body (at most ErrorBodyLimit bytes) into obj, when obj implements error
+//it's returned as the error. A body failed to decode returns an error wrapping the *StatusError.
+func ErrorInto(obj interface{}) DecodeOpt {
+	return func(d *decodeProcessor) {
+		d.errObj = obj
+	}
+}
+
+//ErrorBodyLimit max bytes of the non-2xx response body to read, DefaultErrorBodyLimit by default
+func ErrorBodyLimit(limit int64) DecodeOpt {
+	return func(d *decodeProcessor) {
+		d.limit = limit
+	}
+}
+
+//Decode processor, unmarshal the 2xx response body into obj by the codec matching the response Content-Type.
+//A non-2xx response returns a *StatusError, or a *ProblemError for application/problem+json, unless ErrorInto is set.
+//The typed processors (DecodeJSON, DecodeYAML ...) fail with ErrContentTypeMismatch on a Content-Type of another codec.
+func Decode(obj interface{}, opts ...DecodeOpt) ResponseProcessor {
+	return DecodeWith("", obj, opts...)
+}
+
+//DecodeJSON processor, unmarshal the 2xx json response body into obj
+func DecodeJSON(obj interface{}, opts ...DecodeOpt) ResponseProcessor {
+	return newDecodeProcessor("json", true, obj, opts)
+}
+
+//DecodeXML processor, unmarshal the 2xx xml response body into obj
+func DecodeXML(obj interface{}, opts ...DecodeOpt) ResponseProcessor {
+	return newDecodeProcessor("xml", true, obj, opts)
+}
+
+//DecodeMsgPack processor, unmarshal the 2xx msgpack response body into obj
+func DecodeMsgPack(obj interface{}, opts ...DecodeOpt) ResponseProcessor {
+	return newDecodeProcessor("msgpack", true, obj, opts)
+}
+
+//DecodeCBOR processor, unmarshal the 2xx cbor response body into obj
+func DecodeCBOR(obj interface{}, opts ...DecodeOpt) ResponseProcessor {
+	return newDecodeProcessor("cbor", true, obj, opts)
+}
+
+//DecodeYAML processor, unmarshal the 2xx yaml response body into obj
+func DecodeYAML(obj interface{}, opts ...DecodeOpt) ResponseProcessor {
+	return newDecodeProcessor("yaml", true, obj, opts)
+}
+
+//DecodeWith processor, unmarshal the 2xx response body into obj by the named codec,
+//an empty name picks the codec by the response Content-Type
+func DecodeWith(codecName string, obj interface{}, opts ...DecodeOpt) ResponseProcessor {
+	return newDecodeProcessor(codecName, false, obj, opts)
+}
+
+func newDecodeProcessor(codecName string, strict bool, obj interface{}, opts []DecodeOpt) *decodeProcessor {
+	d := &decodeProcessor{codecName: codecName, strict: strict, obj: obj, limit: DefaultErrorBodyLimit}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+//Process implemention of ResponseProcessor
+func (d *decodeProcessor) Process(ctx context.Context, rsp *http.Response) error {
+	defer drainBody(rsp.Body)
+	codecs := codecsFrom(ctx)
+	if !success(rsp) {
+		return d.statusError(codecs, rsp)
+	}
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 || d.obj == nil {
+		return nil
+	}
+	name, codec, err := d.codec(codecs, rsp)
+	if err != nil {
+		return err
+	}
+	if err := codec.Unmarshal(b, d.obj); err != nil {
+		return errors.Annotatef(err, "%s unmarshal failed", name)
+	}
+	return nil
+}
+
+func (d *decodeProcessor) codec(codecs *CodecRegistry, rsp *http.Response) (string, Codec, error) {
+	ct := rsp.Header.Get("Content-Type")
+	if len(d.codecName) > 0 {
+		codec, ok := codecs.Get(d.codecName)
+		if !ok {
+			return "", nil, errors.Errorf("codec %q not registered", d.codecName)
+		}
+		if d.strict && len(ct) > 0 {
+			if name, _, _ := codecs.Lookup(ct); name != strings.ToLower(d.codecName) {
+				return "", nil, errors.Errorf("%w: %q, %s expected", ErrContentTypeMismatch, ct, d.codecName)
+			}
+		}
+		return d.codecName, codec, nil
+	}
+	if name, codec, ok := codecs.Lookup(ct); ok {
+		return name, codec, nil
+	}
+	return "", nil, errors.Errorf("no codec for Content-Type %q", ct)
+}
+
+func (d *decodeProcessor) statusError(codecs *CodecRegistry, rsp *http.Response) error {
+	if d.errObj == nil && isProblem(rsp) {
+		return decodeProblem(rsp)
+	}
+	serr := newStatusError(rsp, d.limit)
+	if d.errObj == nil || len(serr.Body) == 0 {
+		return serr
+	}
+	_, codec, ok := codecs.Lookup(rsp.Header.Get("Content-Type"))
+	if !ok {
+		if codec, ok = codecs.Get(d.codecName); !ok {
+			return serr
+		}
+	}
+	if err := codec.Unmarshal(serr.Body, d.errObj); err != nil {
+		//eg. the body is larger than the limit
+		return errors.Errorf("%w: error body unmarshal failed (limit %d bytes): %v", serr, d.limit, err)
+	}
+	if err, ok := d.errObj.(error); ok {
+		return err
+	}
+	return serr
+}
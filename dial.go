@@ -0,0 +1,204 @@
+package httpclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/x-mod/errors"
+)
+
+//unixHost the logical host of the unix socket urls, the socket is carried by the request
+const unixHost = "localhost"
+
+//parseURL the url & the socket of the unix socket urls "unix:///path/to.sock:/request/path" &
+//"http+unix://%2Fpath%2Fto.sock/request/path", converted to the http://localhost urls
+func parseURL(raw string) (*url.URL, string, error) {
+	scheme := ""
+	if i := strings.Index(raw, "://"); i > 0 {
+		scheme = strings.ToLower(raw[:i])
+	}
+	switch scheme {
+	case "http+unix":
+		rest := raw[len("http+unix://"):]
+		end := strings.IndexAny(rest, "/?#")
+		if end < 0 {
+			end = len(rest)
+		}
+		socket, err := url.PathUnescape(rest[:end])
+		if err != nil {
+			return nil, "", err
+		}
+		if len(socket) == 0 {
+			return nil, "", errors.Errorf("%q socket path required", raw)
+		}
+		u, err := url.Parse("http://" + unixHost + rest[end:])
+		return u, socket, err
+	case "unix":
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		socket, path := u.Host+u.Path, "/"
+		if i := strings.Index(socket, ":"); i >= 0 {
+			socket, path = socket[:i], socket[i+1:]
+		}
+		if len(socket) == 0 {
+			return nil, "", errors.Errorf("%q socket path required", raw)
+		}
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		return &url.URL{Scheme: "http", Host: unixHost, Path: path, RawQuery: u.RawQuery, Fragment: u.Fragment}, socket, nil
+	}
+	u, err := url.Parse(raw)
+	return u, "", err
+}
+
+//socketTransports the transports of the unix sockets, clones of the client's transport
+type socketTransports struct {
+	base *http.Transport
+	dial DialContext
+
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func (sc *socketTransports) transport(socket string) *http.Transport {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if tr, ok := sc.transports[socket]; ok {
+		return tr
+	}
+	tr := sc.base.Clone()
+	tr.Proxy = nil
+	tr.OnProxyConnectResponse = nil
+	dial := sc.dial
+	tr.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		return dial(ctx, "unix", socket)
+	}
+	sc.transports[socket] = tr
+	return tr
+}
+
+//httpClient of the request, the client of the socket for the unix socket urls
+func (c *Client) httpClient(req *http.Request) (*http.Client, error) {
+	options := requestOptionsFrom(req.Context())
+	if options == nil || len(options.socket) == 0 {
+		return c.Client, nil
+	}
+	if c.config.sockets == nil {
+		return nil, errors.Errorf("%w: unix socket %s unsupported by the custom transport", ErrInvalidURL, options.socket)
+	}
+	checkRedirect := c.Client.CheckRedirect
+	return &http.Client{
+		Transport: c.config.sockets.transport(options.socket),
+		Jar:       c.Client.Jar,
+		//the redirects stay in the socket
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != via[0].URL.Scheme || req.URL.Host != via[0].URL.Host {
+				return errors.Errorf("redirect to %s refused: out of unix socket %s", req.URL.Redacted(), options.socket)
+			}
+			if checkRedirect != nil {
+				return checkRedirect(req, via)
+			}
+			return defaultCheckRedirect(req, via)
+		},
+	}, nil
+}
+
+func defaultCheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+type dialTarget struct {
+	network string
+	//addr of the tcp target without the port keeps the port
+	addr string
+}
+
+type dialTargets struct {
+	targets map[string]dialTarget
+}
+
+//DialTarget opt, connect the logical host at the target, like curl's --connect-to. The url, the Host header,
+//the TLS server name & the cookies keep the logical host. The logical is "host:port", or "host" of any port,
+//the exact "host:port" is preferred. The target is "host:port", "host" keeping the port, or a unix socket
+//"unix:///path/to.sock". The logical hosts are connected directly, not by the proxies.
+func DialTarget(logical string, target string) Opt {
+	return func(cf *config) {
+		if cf.targets == nil {
+			cf.targets = &dialTargets{targets: make(map[string]dialTarget)}
+		}
+		logical = strings.ToLower(logical)
+		if host, port, err := net.SplitHostPort(logical); err == nil {
+			logical = net.JoinHostPort(host, port)
+		} else {
+			logical = strings.Trim(logical, "[]")
+		}
+		t := dialTarget{network: "tcp", addr: target}
+		if strings.HasPrefix(target, "unix://") {
+			t = dialTarget{network: "unix", addr: strings.TrimPrefix(target, "unix://")}
+		} else if strings.HasPrefix(target, "/") {
+			t = dialTarget{network: "unix", addr: target}
+		}
+		cf.targets.targets[logical] = t
+	}
+}
+
+//lookup the target of the host
+func (dt *dialTargets) lookup(host string, port string) (dialTarget, bool) {
+	if dt == nil {
+		return dialTarget{}, false
+	}
+	host = strings.ToLower(host)
+	if t, ok := dt.targets[net.JoinHostPort(host, port)]; ok {
+		return t, true
+	}
+	t, ok := dt.targets[host]
+	return t, ok
+}
+
+//match the hosts connected to the targets
+func (dt *dialTargets) match(host string, port string) bool {
+	_, ok := dt.lookup(host, port)
+	return ok
+}
+
+//checkRedirect refuse the redirects into the unix socket targets from the other hosts
+func (dt *dialTargets) checkRedirect(req *http.Request, via []*http.Request) error {
+	if t, ok := dt.lookup(req.URL.Hostname(), urlPort(req.URL)); ok && t.network == "unix" {
+		if from, ok := dt.lookup(via[0].URL.Hostname(), urlPort(via[0].URL)); !ok || from != t {
+			return errors.Errorf("redirect to %s refused: unix socket target", req.URL.Redacted())
+		}
+	}
+	return defaultCheckRedirect(req, via)
+}
+
+//dialer connect the logical hosts at the targets
+func (dt *dialTargets) dialer(dial DialContext) DialContext {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dial(ctx, network, addr)
+		}
+		t, ok := dt.lookup(host, port)
+		if !ok {
+			return dial(ctx, network, addr)
+		}
+		if t.network == "unix" {
+			return dial(ctx, "unix", t.addr)
+		}
+		target := t.addr
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			target = net.JoinHostPort(strings.Trim(target, "[]"), port)
+		}
+		return dial(ctx, network, target)
+	}
+}
@@ -0,0 +1,275 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/x-mod/errors"
+)
+
+//digest algorithms supported, the strongest offered is chosen
+var digestAlgorithms = map[string]func() hash.Hash{
+	"SHA-256":      sha256.New,
+	"SHA-256-SESS": sha256.New,
+	"MD5":          md5.New,
+	"MD5-SESS":     md5.New,
+}
+
+var digestPreference = []string{"SHA-256", "SHA-256-SESS", "MD5", "MD5-SESS"}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	userhash  bool
+	nc        uint32
+}
+
+type digestAuth struct {
+	username   string
+	password   string
+	cnonce     func() string
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+//Digest authenticator (RFC 7616), it responds to the WWW-Authenticate Digest challenge with
+//MD5, SHA-256 & their -sess variants, qop auth or auth-int. The challenge is cached per host,
+//so the later requests go out pre-authorized with the incremented nonce count.
+func Digest(username string, password string) Authenticator {
+	return &digestAuth{
+		username:   username,
+		password:   password,
+		cnonce:     newCnonce,
+		challenges: make(map[string]*digestChallenge),
+	}
+}
+
+func newCnonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+//Authenticate implemention of Authenticator, nothing is sent until a challenge of the host is cached
+func (d *digestAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	d.mu.Lock()
+	ch, ok := d.challenges[req.URL.Host]
+	var nc uint32
+	var c digestChallenge
+	if ok {
+		ch.nc++
+		nc, c = ch.nc, *ch
+	}
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	bodyHash := ""
+	if c.qop == "auth-int" {
+		h, err := hashBody(req, digestAlgorithms[c.algorithm])
+		if err != nil {
+			return errors.Annotate(err, "digest auth-int")
+		}
+		bodyHash = hex.EncodeToString(h)
+	}
+	req.Header.Set("Authorization", d.authorization(&c, req.Method, req.URL.RequestURI(), nc, d.cnonce(), bodyHash))
+	return nil
+}
+
+//HandleChallenge implemention of ChallengeHandler
+func (d *digestAuth) HandleChallenge(ctx context.Context, req *http.Request, rsp *http.Response) (bool, error) {
+	var chosen *digestChallenge
+	rank := len(digestPreference)
+	for _, challenge := range parseChallenges(rsp.Header["Www-Authenticate"]) {
+		if !strings.EqualFold(challenge.scheme, "Digest") {
+			continue
+		}
+		p := challenge.params
+		algorithm := strings.ToUpper(p["algorithm"])
+		if len(algorithm) == 0 {
+			algorithm = "MD5"
+		}
+		r := -1
+		for i, a := range digestPreference {
+			if a == algorithm {
+				r = i
+			}
+		}
+		if r < 0 || r >= rank {
+			continue
+		}
+		qop := ""
+		if len(p["qop"]) > 0 {
+			for _, q := range strings.Split(p["qop"], ",") {
+				q = strings.ToLower(strings.TrimSpace(q))
+				if q == "auth" || (q == "auth-int" && len(qop) == 0) {
+					qop = q
+				}
+			}
+			if len(qop) == 0 {
+				continue
+			}
+		}
+		rank = r
+		chosen = &digestChallenge{
+			realm:     p["realm"],
+			nonce:     p["nonce"],
+			opaque:    p["opaque"],
+			algorithm: algorithm,
+			qop:       qop,
+			userhash:  strings.EqualFold(p["userhash"], "true"),
+		}
+	}
+	if chosen == nil {
+		return false, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev, ok := d.challenges[req.URL.Host]
+	//the credentials are rejected with the same nonce, a stale nonce is renewed
+	if ok && prev.nonce == chosen.nonce && strings.HasPrefix(req.Header.Get("Authorization"), "Digest ") {
+		delete(d.challenges, req.URL.Host)
+		return false, nil
+	}
+	d.challenges[req.URL.Host] = chosen
+	return true, nil
+}
+
+//authorization header of the challenge
+func (d *digestAuth) authorization(c *digestChallenge, method string, uri string, nc uint32, cnonce string, bodyHash string) string {
+	h := func(s string) string {
+		hh := digestAlgorithms[c.algorithm]()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	ncs := fmt.Sprintf("%08x", nc)
+	ha1 := h(d.username + ":" + c.realm + ":" + d.password)
+	if strings.HasSuffix(c.algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	a2 := method + ":" + uri
+	if c.qop == "auth-int" {
+		a2 += ":" + bodyHash
+	}
+	response := ""
+	if len(c.qop) > 0 {
+		response = h(strings.Join([]string{ha1, c.nonce, ncs, cnonce, c.qop, h(a2)}, ":"))
+	} else {
+		response = h(ha1 + ":" + c.nonce + ":" + h(a2))
+	}
+	username := d.username
+	if c.userhash {
+		username = h(d.username + ":" + c.realm)
+	}
+	params := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", c.realm),
+		fmt.Sprintf("uri=%q", uri),
+		fmt.Sprintf("algorithm=%s", c.algorithm),
+		fmt.Sprintf("nonce=%q", c.nonce),
+	}
+	if len(c.qop) > 0 {
+		params = append(params, fmt.Sprintf("nc=%s", ncs), fmt.Sprintf("cnonce=%q", cnonce), fmt.Sprintf("qop=%s", c.qop))
+	}
+	params = append(params, fmt.Sprintf("response=%q", response))
+	if len(c.opaque) > 0 {
+		params = append(params, fmt.Sprintf("opaque=%q", c.opaque))
+	}
+	if c.userhash {
+		params = append(params, "userhash=true")
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+//hashBody hash of a copy of the request body
+func hashBody(req *http.Request, newHash func() hash.Hash) ([]byte, error) {
+	hh := newHash()
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errors.New("hash of the request body requires a replayable request body")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, errors.Annotate(err, "request body rewind")
+		}
+		defer body.Close()
+		if _, err := io.Copy(hh, body); err != nil {
+			return nil, err
+		}
+	}
+	return hh.Sum(nil), nil
+}
+
+type challenge struct {
+	scheme string
+	params map[string]string
+}
+
+//parseChallenges of WWW-Authenticate values (RFC 9110 11.6.1), a value may hold several challenges
+func parseChallenges(values []string) []challenge {
+	challenges := []challenge{}
+	for _, value := range values {
+		s := value
+		var cur *challenge
+		for {
+			s = strings.TrimLeft(s, " \t,")
+			if len(s) == 0 {
+				break
+			}
+			token := s
+			if i := strings.IndexAny(s, " \t,="); i >= 0 {
+				token = s[:i]
+			}
+			rest := strings.TrimLeft(s[len(token):], " \t")
+			if cur != nil && strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, "==") {
+				//auth-param
+				rest = strings.TrimLeft(rest[1:], " \t")
+				v := ""
+				if strings.HasPrefix(rest, `"`) {
+					b := strings.Builder{}
+					i := 1
+					for ; i < len(rest) && rest[i] != '"'; i++ {
+						if rest[i] == '\\' && i+1 < len(rest) {
+							i++
+						}
+						b.WriteByte(rest[i])
+					}
+					if i < len(rest) {
+						i++
+					}
+					v, rest = b.String(), rest[i:]
+				} else {
+					end := strings.IndexAny(rest, " \t,")
+					if end < 0 {
+						end = len(rest)
+					}
+					v, rest = rest[:end], rest[end:]
+				}
+				cur.params[strings.ToLower(token)] = v
+				s = rest
+				continue
+			}
+			if cur != nil && strings.HasPrefix(rest, "=") {
+				//token68
+				s = strings.TrimLeft(rest, "=")
+				continue
+			}
+			challenges = append(challenges, challenge{scheme: token, params: make(map[string]string)})
+			cur = &challenges[len(challenges)-1]
+			s = rest
+		}
+	}
+	return challenges
+}
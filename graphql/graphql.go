@@ -0,0 +1,462 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	json "github.com/json-iterator/go"
+	"github.com/x-mod/errors"
+	"github.com/x-mod/httpclient"
+)
+
+//DefaultResponseLimit max bytes of a graphql response body, a larger one fails with a *httpclient.BodyTooLargeError
+var DefaultResponseLimit int64 = 32 << 20
+
+//Client graphql client over the httpclient.Client, requests go through Client.Execute
+type Client struct {
+	client    *httpclient.Client
+	endpoint  string
+	opts      []httpclient.ReqOpt
+	persisted bool
+	usingGET  bool
+}
+
+//Opt of graphql client
+type Opt func(*Client)
+
+//RequestOpts opt, options applied to every graphql request, eg. headers
+func RequestOpts(opts ...httpclient.ReqOpt) Opt {
+	return func(c *Client) {
+		c.opts = append(c.opts, opts...)
+	}
+}
+
+//PersistedQueries opt, automatic persisted queries: the sha256 hash is sent instead of the query,
+//which is sent again in full when the server replies PersistedQueryNotFound.
+//With usingGET the hash-only queries are sent by GET, so they can be cached, the mutations & the documents
+//without a clear query operation are always POSTed.
+func PersistedQueries(usingGET bool) Opt {
+	return func(c *Client) {
+		c.persisted = true
+		c.usingGET = usingGET
+	}
+}
+
+//New graphql client of the endpoint, the endpoint is resolved against the client's base url
+func New(client *httpclient.Client, endpoint string, opts ...Opt) *Client {
+	c := &Client{client: client, endpoint: endpoint}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type upload struct {
+	path     string
+	filename string
+	rd       io.Reader
+}
+
+//Request graphql operation
+type Request struct {
+	Query         string
+	OperationName string
+	Variables     map[string]interface{}
+	uploads       []upload
+}
+
+//NewRequest of the query or mutation
+func NewRequest(query string) *Request {
+	return &Request{Query: query, Variables: make(map[string]interface{})}
+}
+
+//Var set a variable
+func (r *Request) Var(name string, value interface{}) *Request {
+	r.Variables[name] = value
+	return r
+}
+
+//Operation set the operation name
+func (r *Request) Operation(name string) *Request {
+	r.OperationName = name
+	return r
+}
+
+//File upload the file as the variable at the path (dot separated, eg. "file" or "files.0"),
+//the request is sent as multipart/form-data (https://github.com/jaydenseric/graphql-multipart-request-spec).
+//A variable nested in a list or object must be set to nil by Var.
+func (r *Request) File(path string, filename string, rd io.Reader) *Request {
+	if !strings.Contains(path, ".") {
+		if _, ok := r.Variables[path]; !ok {
+			r.Variables[path] = nil
+		}
+	}
+	r.uploads = append(r.uploads, upload{path: path, filename: filename, rd: rd})
+	return r
+}
+
+//query the request clearly selects a query operation, by the OperationName or the only operation of the document,
+//so it can be sent by GET. Mutations, subscriptions & the unclear documents are POSTed.
+func (r *Request) query() bool {
+	defs := definitions(r.Query)
+	if defs == nil {
+		return false
+	}
+	var selected *definition
+	for i := range defs {
+		def := &defs[i]
+		if def.keyword == "fragment" {
+			continue
+		}
+		if len(r.OperationName) > 0 && def.name != r.OperationName {
+			continue
+		}
+		if selected != nil {
+			return false
+		}
+		selected = def
+	}
+	return selected != nil && selected.keyword == "query"
+}
+
+//definition of the document, the keyword is query, mutation, subscription or fragment
+type definition struct {
+	keyword string
+	name    string
+}
+
+//definitions the top level definitions of the document, the shorthand "{ ... }" is a query, nil if malformed
+func definitions(doc string) []definition {
+	defs := []definition{}
+	depth := 0
+	//expecting the next definition, naming the last one
+	expecting, naming := true, false
+	for i := 0; i < len(doc); {
+		c := doc[i]
+		switch {
+		case c == '#':
+			for i < len(doc) && doc[i] != '\n' && doc[i] != '\r' {
+				i++
+			}
+			continue
+		case c == '"':
+			if i = skipString(doc, i); i < 0 {
+				return nil
+			}
+			continue
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			j := i + 1
+			for j < len(doc) && (doc[j] == '_' || 'a' <= doc[j] && doc[j] <= 'z' || 'A' <= doc[j] && doc[j] <= 'Z' || '0' <= doc[j] && doc[j] <= '9') {
+				j++
+			}
+			token := doc[i:j]
+			i = j
+			if depth > 0 {
+				continue
+			}
+			if expecting {
+				defs = append(defs, definition{keyword: token})
+				expecting, naming = false, true
+			} else if naming {
+				defs[len(defs)-1].name = token
+				naming = false
+			}
+			continue
+		case c == '{' || c == '(' || c == '[':
+			if depth == 0 && c == '{' && expecting {
+				defs = append(defs, definition{keyword: "query"})
+				expecting = false
+			}
+			naming = false
+			depth++
+		case c == '}' || c == ')' || c == ']':
+			if depth--; depth < 0 {
+				return nil
+			}
+			if depth == 0 && c == '}' {
+				expecting = true
+			}
+		case c == '@':
+			naming = false
+		}
+		i++
+	}
+	if depth != 0 {
+		return nil
+	}
+	return defs
+}
+
+//skipString the index after the string (or block string) starting at i, -1 if unterminated
+func skipString(doc string, i int) int {
+	if strings.HasPrefix(doc[i:], `"""`) {
+		for j := i + 3; j < len(doc); j++ {
+			if doc[j] == '\\' && strings.HasPrefix(doc[j+1:], `"""`) {
+				j += 3
+				continue
+			}
+			if strings.HasPrefix(doc[j:], `"""`) {
+				return j + 3
+			}
+		}
+		return -1
+	}
+	for j := i + 1; j < len(doc); j++ {
+		switch doc[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		case '\n', '\r':
+			return -1
+		}
+	}
+	return -1
+}
+
+type payload struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+//Location in the query
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+//Error of the graphql response
+type Error struct {
+	Message string `json:"message"`
+	//Path of the response field, string keys & int indexes
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+//Error implemention
+func (e *Error) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	path := make([]string, 0, len(e.Path))
+	for _, p := range e.Path {
+		path = append(path, fmt.Sprint(p))
+	}
+	return fmt.Sprintf("%s (path %s)", e.Message, strings.Join(path, "."))
+}
+
+//Code extensions.code of the error, empty if not set
+func (e *Error) Code() string {
+	if code, ok := e.Extensions["code"].(string); ok {
+		return code
+	}
+	return ""
+}
+
+//Errors the errors[] of a graphql response, the data is decoded too if the response has some
+type Errors []*Error
+
+//Error implemention
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+//Unwrap the errors, so errors.As matches any *Error
+func (e Errors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func (e Errors) persistedQueryNotFound() bool {
+	for _, err := range e {
+		if err.Message == "PersistedQueryNotFound" || err.Code() == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors Errors          `json:"errors"`
+}
+
+//Do send the request & decode the data into the target (nil to discard), errors[] are returned as Errors
+func (c *Client) Do(ctx context.Context, req *Request, data interface{}, opts ...httpclient.ReqOpt) error {
+	if len(req.uploads) > 0 {
+		body, err := multipartBody(req)
+		if err != nil {
+			return err
+		}
+		return c.execute(ctx, data, opts, body)
+	}
+	if !c.persisted {
+		return c.execute(ctx, data, opts, postBody(req, nil))
+	}
+	sum := sha256.Sum256([]byte(req.Query))
+	extensions := map[string]interface{}{
+		"persistedQuery": map[string]interface{}{
+			"version":    1,
+			"sha256Hash": hex.EncodeToString(sum[:]),
+		},
+	}
+	hashed := postBody(&Request{OperationName: req.OperationName, Variables: req.Variables}, extensions)
+	if c.usingGET && req.query() {
+		var err error
+		if hashed, err = getQueries(req, extensions); err != nil {
+			return err
+		}
+	}
+	err := c.execute(ctx, data, opts, hashed)
+	if errs, ok := err.(Errors); ok && errs.persistedQueryNotFound() {
+		return c.execute(ctx, data, opts, postBody(req, extensions))
+	}
+	return err
+}
+
+func (c *Client) execute(ctx context.Context, data interface{}, opts []httpclient.ReqOpt, body []httpclient.ReqOpt) error {
+	reqOpts := append([]httpclient.ReqOpt{
+		httpclient.SetURL(c.endpoint),
+		httpclient.Header("Accept", "application/graphql-response+json, application/json"),
+	}, c.opts...)
+	reqOpts = append(append(reqOpts, opts...), body...)
+	hr, err := c.client.MakeRequest(reqOpts...)
+	if err != nil {
+		return err
+	}
+	return c.client.Execute(ctx, hr, httpclient.LimitBody(DefaultResponseLimit, &processor{data: data}))
+}
+
+func postBody(req *Request, extensions map[string]interface{}) []httpclient.ReqOpt {
+	return []httpclient.ReqOpt{
+		httpclient.Method(http.MethodPost),
+		httpclient.Content(httpclient.JSON(&payload{
+			Query:         req.Query,
+			OperationName: req.OperationName,
+			Variables:     req.Variables,
+			Extensions:    extensions,
+		})),
+	}
+}
+
+func getQueries(req *Request, extensions map[string]interface{}) ([]httpclient.ReqOpt, error) {
+	opts := []httpclient.ReqOpt{httpclient.Method(http.MethodGet)}
+	if len(req.OperationName) > 0 {
+		opts = append(opts, httpclient.Query("operationName", req.OperationName))
+	}
+	if len(req.Variables) > 0 {
+		b, err := json.Marshal(req.Variables)
+		if err != nil {
+			return nil, errors.Annotate(err, "graphql variables marshal")
+		}
+		opts = append(opts, httpclient.Query("variables", string(b)))
+	}
+	b, err := json.Marshal(extensions)
+	if err != nil {
+		return nil, errors.Annotate(err, "graphql extensions marshal")
+	}
+	return append(opts, httpclient.Query("extensions", string(b))), nil
+}
+
+//multipart request: operations, map & the files
+func multipartBody(req *Request) ([]httpclient.ReqOpt, error) {
+	buf := &bytes.Buffer{}
+	wr := multipart.NewWriter(buf)
+	operations, err := json.Marshal(&payload{
+		Query:         req.Query,
+		OperationName: req.OperationName,
+		Variables:     req.Variables,
+	})
+	if err != nil {
+		return nil, errors.Annotate(err, "graphql operations marshal")
+	}
+	files := make(map[string][]string, len(req.uploads))
+	for i, up := range req.uploads {
+		files[fmt.Sprint(i)] = []string{"variables." + up.path}
+	}
+	fileMap, err := json.Marshal(files)
+	if err != nil {
+		return nil, errors.Annotate(err, "graphql map marshal")
+	}
+	if err := wr.WriteField("operations", string(operations)); err != nil {
+		return nil, err
+	}
+	if err := wr.WriteField("map", string(fileMap)); err != nil {
+		return nil, err
+	}
+	for i, up := range req.uploads {
+		part, err := wr.CreateFormFile(fmt.Sprint(i), up.filename)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(part, up.rd); err != nil {
+			return nil, errors.Annotatef(err, "graphql upload %s", up.filename)
+		}
+	}
+	if err := wr.Close(); err != nil {
+		return nil, err
+	}
+	return []httpclient.ReqOpt{
+		httpclient.Method(http.MethodPost),
+		httpclient.Content(httpclient.Binary(buf.Bytes()), httpclient.ContentType(wr.FormDataContentType())),
+	}, nil
+}
+
+type processor struct {
+	data interface{}
+}
+
+//Process implemention of ResponseProcessor
+func (p *processor) Process(ctx context.Context, rsp *http.Response) error {
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	gr := response{}
+	if err := json.Unmarshal(b, &gr); err != nil || (len(gr.Data) == 0 && len(gr.Errors) == 0) {
+		//not a graphql response
+		r := *rsp
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if serr := httpclient.ExpectStatus().Process(ctx, &r); serr != nil {
+			return serr
+		}
+		if err != nil {
+			return errors.Annotate(err, "graphql response decode")
+		}
+		return errors.New("graphql response without data or errors")
+	}
+	if p.data != nil && len(gr.Data) > 0 && string(gr.Data) != "null" {
+		if err := json.Unmarshal(gr.Data, p.data); err != nil {
+			return errors.Annotate(err, "graphql data decode")
+		}
+	}
+	if len(gr.Errors) > 0 {
+		for _, e := range gr.Errors {
+			for i, v := range e.Path {
+				if f, ok := v.(float64); ok {
+					e.Path[i] = int(f)
+				}
+			}
+		}
+		return gr.Errors
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/x-mod/httpclient"
+)
+
+func TestClient_Do(t *testing.T) {
+	const query = `query Hero($id: ID!) { hero(id: $id) { name friends { name } } }`
+	persisted := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/upload" {
+			assert.Nil(t, r.ParseMultipartForm(1<<20))
+			assert.JSONEq(t, `{"query":"mutation($file: Upload!) { upload(file: $file) }","variables":{"file":null}}`, r.FormValue("operations"))
+			assert.JSONEq(t, `{"0":["variables.file"]}`, r.FormValue("map"))
+			f, hdr, err := r.FormFile("0")
+			assert.Nil(t, err)
+			b, _ := ioutil.ReadAll(f)
+			w.Write([]byte(`{"data":{"upload":"` + hdr.Filename + `:` + string(b) + `"}}`))
+			return
+		}
+		p := payload{}
+		if r.Method == http.MethodGet {
+			json.Unmarshal([]byte(r.URL.Query().Get("variables")), &p.Variables)
+			json.Unmarshal([]byte(r.URL.Query().Get("extensions")), &p.Extensions)
+		} else {
+			json.NewDecoder(r.Body).Decode(&p)
+		}
+		if p.Extensions != nil {
+			if len(p.Query) == 0 && !persisted {
+				w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+				return
+			}
+			persisted = true
+		} else {
+			assert.Equal(t, query, p.Query)
+		}
+		assert.Equal(t, "1000", p.Variables["id"])
+		w.Write([]byte(`{"data":{"hero":{"name":"Luke","friends":[{"name":"Han"},null]}},
+			"errors":[{"message":"friend not found","path":["hero","friends",1],"locations":[{"line":1,"column":40}],"extensions":{"code":"NOT_FOUND"}}]}`))
+	}))
+	defer ts.Close()
+
+	var data struct {
+		Hero struct {
+			Name    string
+			Friends []*struct{ Name string }
+		}
+	}
+	client := httpclient.New(httpclient.BaseURL(ts.URL))
+	err := New(client, "/graphql").Do(context.TODO(), NewRequest(query).Var("id", "1000").Operation("Hero"), &data)
+	errs, ok := err.(Errors)
+	assert.True(t, ok)
+	if ok {
+		assert.Len(t, errs, 1)
+		assert.Equal(t, []interface{}{"hero", "friends", 1}, errs[0].Path)
+		assert.Equal(t, []Location{{Line: 1, Column: 40}}, errs[0].Locations)
+		assert.Equal(t, "NOT_FOUND", errs[0].Code())
+		assert.Equal(t, "graphql: friend not found (path hero.friends.1)", err.Error())
+	}
+	assert.Equal(t, "Luke", data.Hero.Name)
+	assert.Len(t, data.Hero.Friends, 2)
+
+	//automatic persisted queries, the full query is sent once
+	apq := New(client, "/graphql", PersistedQueries(true))
+	for i := 0; i < 2; i++ {
+		err = apq.Do(context.TODO(), NewRequest(query).Var("id", "1000"), nil)
+		_, ok = err.(Errors)
+		assert.True(t, ok)
+	}
+	assert.True(t, persisted)
+
+	//multipart upload
+	var uploaded struct{ Upload string }
+	upload := NewRequest("mutation($file: Upload!) { upload(file: $file) }").File("file", "a.txt", strings.NewReader("hello"))
+	assert.Nil(t, New(client, "/upload").Do(context.TODO(), upload, &uploaded))
+	assert.Equal(t, "a.txt:hello", uploaded.Upload)
+
+	//not a graphql response
+	err = New(client, "/missing").Do(context.TODO(), NewRequest(query), nil)
+	serr, ok := err.(*httpclient.StatusError)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, http.StatusNotFound, serr.StatusCode)
+	}
+
+	limit := DefaultResponseLimit
+	DefaultResponseLimit = 8
+	err = New(client, "/graphql").Do(context.TODO(), NewRequest(query).Var("id", "1000"), nil)
+	assert.True(t, errors.Is(err, httpclient.ErrBodyTooLarge))
+	DefaultResponseLimit = limit
+}
+
+func TestRequest_query(t *testing.T) {
+	assert.True(t, NewRequest("{ a }").query())
+	assert.True(t, NewRequest("\ufeff # get\n  , query Get($a: Int = 1) @cached { a(s: \"}\") }").query())
+	assert.True(t, NewRequest("fragment F on T { a } query Q { ...F }").query())
+	assert.False(t, NewRequest("mutation { a }").query())
+	assert.False(t, NewRequest("# query\nmutation { a }").query())
+	assert.False(t, NewRequest("subscription { a }").query())
+	assert.False(t, NewRequest("{ a").query())
+	//fragment first
+	assert.False(t, NewRequest("fragment F on T { a } mutation M { ...F }").query())
+	//several operations, selected by the name
+	multi := "query Q { a } mutation M { b }"
+	assert.False(t, NewRequest(multi).query())
+	assert.False(t, NewRequest(multi).Operation("M").query())
+	assert.True(t, NewRequest(multi).Operation("Q").query())
+	assert.False(t, NewRequest(multi).Operation("X").query())
+}
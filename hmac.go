@@ -0,0 +1,266 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/x-mod/errors"
+)
+
+//ErrInvalidSignature the signature of the request is not verified
+var ErrInvalidSignature = errors.New("invalid signature")
+
+//HMACRequest the parts of the request for the canonical string
+type HMACRequest struct {
+	Method string
+	Host   string
+	//Path escaped, "/" for empty
+	Path string
+	//Query sorted by key
+	Query string
+	//Header of the request
+	Header http.Header
+	//Headers included, "name:value" lines of the lower case names in order
+	Headers   string
+	Timestamp string
+	Nonce     string
+	//BodyHash hex of the body hash
+	BodyHash string
+}
+
+//CanonicalFunc make the string to sign of the request
+type CanonicalFunc func(r *HMACRequest) (string, error)
+
+//DefaultCanonical method, path, sorted query, included headers, timestamp, nonce & body hash joined by newlines
+func DefaultCanonical(r *HMACRequest) (string, error) {
+	return strings.Join([]string{r.Method, r.Path, r.Query, r.Headers, r.Timestamp, r.Nonce, r.BodyHash}, "\n"), nil
+}
+
+type hmacSigner struct {
+	key       []byte
+	hash      func() hash.Hash
+	canonical CanonicalFunc
+	headers   []string
+	timestamp string
+	layout    string
+	nonce     string
+	signature string
+	format    func(signature []byte) string
+	now       func() time.Time
+	errs      []error
+}
+
+//HMACOpt of the hmac signer
+type HMACOpt func(*hmacSigner)
+
+//HMACHash opt, the hash of the hmac & the body hash, sha256 by default
+func HMACHash(h func() hash.Hash) HMACOpt {
+	return func(s *hmacSigner) {
+		s.hash = h
+	}
+}
+
+//HMACCanonical opt, the canonicalization function, DefaultCanonical by default
+func HMACCanonical(fn CanonicalFunc) HMACOpt {
+	return func(s *hmacSigner) {
+		s.canonical = fn
+	}
+}
+
+//HMACTemplate opt, the canonicalization text/template of the HMACRequest,
+//eg. "{{.Method}}\n{{.Path}}\n{{.Query}}\n{{.Timestamp}}\n{{.BodyHash}}" or {{.Header.Get "X-Key"}}
+func HMACTemplate(text string) HMACOpt {
+	return func(s *hmacSigner) {
+		tmpl, err := template.New("hmac").Parse(text)
+		if err != nil {
+			s.errs = append(s.errs, errors.Annotate(err, "hmac template"))
+			return
+		}
+		s.canonical = func(r *HMACRequest) (string, error) {
+			b := &strings.Builder{}
+			if err := tmpl.Execute(b, r); err != nil {
+				return "", errors.Annotate(err, "hmac template")
+			}
+			return b.String(), nil
+		}
+	}
+}
+
+//HMACHeaders opt, the headers included in order, a missing header is included empty
+func HMACHeaders(names ...string) HMACOpt {
+	return func(s *hmacSigner) {
+		s.headers = append(s.headers, names...)
+	}
+}
+
+//HMACTimestamp opt, the timestamp header of the time layout, unix seconds for an empty layout
+func HMACTimestamp(header string, layout string) HMACOpt {
+	return func(s *hmacSigner) {
+		s.timestamp = header
+		s.layout = layout
+	}
+}
+
+//HMACNonce opt, the random nonce header
+func HMACNonce(header string) HMACOpt {
+	return func(s *hmacSigner) {
+		s.nonce = header
+	}
+}
+
+//HMACSignatureHeader opt, the header & the format of the signature, "X-Signature" in hex by default,
+//eg. "Authorization" with "HMAC key-id:" + base64
+func HMACSignatureHeader(header string, format func(signature []byte) string) HMACOpt {
+	return func(s *hmacSigner) {
+		s.signature = header
+		s.format = format
+	}
+}
+
+//HMACClock opt, the time of signing
+func HMACClock(now func() time.Time) HMACOpt {
+	return func(s *hmacSigner) {
+		s.now = now
+	}
+}
+
+func newHMACSigner(key []byte, opts []HMACOpt) *hmacSigner {
+	s := &hmacSigner{
+		key:       key,
+		hash:      sha256.New,
+		canonical: DefaultCanonical,
+		signature: "X-Signature",
+		format:    hex.EncodeToString,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+//HMACSigner signer of a custom hmac scheme, the canonical string of the request is signed by the key.
+//Use it by the Signing or Sign opt, the request is signed again per attempt with a new timestamp & nonce.
+func HMACSigner(key []byte, opts ...HMACOpt) Signer {
+	return newHMACSigner(key, opts)
+}
+
+//Sign implemention of Signer
+func (s *hmacSigner) Sign(ctx context.Context, req *http.Request) error {
+	if len(s.errs) > 0 {
+		return s.errs[0]
+	}
+	if len(s.timestamp) > 0 {
+		t := s.now()
+		if len(s.layout) == 0 {
+			req.Header.Set(s.timestamp, strconv.FormatInt(t.Unix(), 10))
+		} else {
+			req.Header.Set(s.timestamp, t.UTC().Format(s.layout))
+		}
+	}
+	if len(s.nonce) > 0 {
+		b := make([]byte, 16)
+		rand.Read(b)
+		req.Header.Set(s.nonce, hex.EncodeToString(b))
+	}
+	mac, err := s.sum(req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(s.signature, s.format(mac))
+	return nil
+}
+
+//sum the hmac of the request
+func (s *hmacSigner) sum(req *http.Request) ([]byte, error) {
+	body, err := hashBody(req, s.hash)
+	if err != nil {
+		return nil, err
+	}
+	r := &HMACRequest{
+		Method:   req.Method,
+		Host:     req.Host,
+		Path:     req.URL.EscapedPath(),
+		Query:    req.URL.Query().Encode(),
+		Header:   req.Header,
+		BodyHash: hex.EncodeToString(body),
+	}
+	if len(r.Host) == 0 {
+		r.Host = req.URL.Host
+	}
+	if len(r.Path) == 0 {
+		r.Path = "/"
+	}
+	lines := make([]string, len(s.headers))
+	for i, name := range s.headers {
+		lines[i] = strings.ToLower(name) + ":" + strings.TrimSpace(strings.Join(req.Header.Values(name), ","))
+	}
+	r.Headers = strings.Join(lines, "\n")
+	if len(s.timestamp) > 0 {
+		r.Timestamp = req.Header.Get(s.timestamp)
+	}
+	if len(s.nonce) > 0 {
+		r.Nonce = req.Header.Get(s.nonce)
+	}
+	canonical, err := s.canonical(r)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(s.hash, s.key)
+	mac.Write([]byte(canonical))
+	return mac.Sum(nil), nil
+}
+
+//VerifyHMAC verify the request signed by HMACSigner of the same key & options, eg. in a test server.
+//The body is read & kept for the handler.
+func VerifyHMAC(req *http.Request, key []byte, opts ...HMACOpt) error {
+	s := newHMACSigner(key, opts)
+	if len(s.errs) > 0 {
+		return s.errs[0]
+	}
+	if err := bufferBody(req); err != nil {
+		return err
+	}
+	for _, header := range []string{s.signature, s.timestamp, s.nonce} {
+		if len(header) > 0 && len(req.Header.Get(header)) == 0 {
+			return errors.Errorf("%w: %s missing", ErrInvalidSignature, header)
+		}
+	}
+	mac, err := s.sum(req)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(s.format(mac)), []byte(req.Header.Get(s.signature))) {
+		return errors.Errorf("%w: %s mismatch", ErrInvalidSignature, s.signature)
+	}
+	return nil
+}
+
+//bufferBody read the body of the received request, so it can be read again
+func bufferBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/x-mod/errors"
+)
+
+//DefaultSignatureComponents covered by the message signature
+var DefaultSignatureComponents = []string{"@method", "@target-uri", "content-digest"}
+
+type messageSigner struct {
+	keyID      string
+	key        []byte
+	label      string
+	components []string
+	nonce      bool
+	expires    time.Duration
+	tag        string
+	now        func() time.Time
+}
+
+//MessageSignatureOpt of the message signer
+type MessageSignatureOpt func(*messageSigner)
+
+//SignatureComponents opt, the covered components, eg. "@method", "@authority", "@path", "@query", "content-type".
+//"content-digest" (RFC 9530) is computed by sha-256 of the body when the request has none.
+func SignatureComponents(components ...string) MessageSignatureOpt {
+	return func(s *messageSigner) {
+		s.components = components
+	}
+}
+
+//SignatureLabel opt, the label of Signature-Input & Signature, "sig1" by default
+func SignatureLabel(label string) MessageSignatureOpt {
+	return func(s *messageSigner) {
+		s.label = label
+	}
+}
+
+//SignatureNonce opt, sign with a random nonce parameter
+func SignatureNonce() MessageSignatureOpt {
+	return func(s *messageSigner) {
+		s.nonce = true
+	}
+}
+
+//SignatureExpires opt, sign with the expires parameter after the created time
+func SignatureExpires(d time.Duration) MessageSignatureOpt {
+	return func(s *messageSigner) {
+		s.expires = d
+	}
+}
+
+//SignatureTag opt, sign with the tag parameter of the application
+func SignatureTag(tag string) MessageSignatureOpt {
+	return func(s *messageSigner) {
+		s.tag = tag
+	}
+}
+
+//SignatureClock opt, the time of signing
+func SignatureClock(now func() time.Time) MessageSignatureOpt {
+	return func(s *messageSigner) {
+		s.now = now
+	}
+}
+
+//MessageSignature signer of HTTP Message Signatures (RFC 9421) by hmac-sha256 of the shared key,
+//the Signature-Input & Signature headers are set per attempt.
+func MessageSignature(keyID string, key []byte, opts ...MessageSignatureOpt) Signer {
+	s := &messageSigner{
+		keyID:      keyID,
+		key:        key,
+		label:      "sig1",
+		components: DefaultSignatureComponents,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+//Sign implemention of Signer
+func (s *messageSigner) Sign(ctx context.Context, req *http.Request) error {
+	for _, c := range s.components {
+		if strings.ToLower(c) == "content-digest" && len(req.Header.Get("Content-Digest")) == 0 {
+			sum, err := hashBody(req, sha256.New)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum)+":")
+		}
+	}
+	created := s.now()
+	quoted := make([]string, len(s.components))
+	for i, c := range s.components {
+		quoted[i] = strconv.Quote(strings.ToLower(c))
+	}
+	params := "(" + strings.Join(quoted, " ") + ");created=" + strconv.FormatInt(created.Unix(), 10)
+	if s.expires > 0 {
+		params += ";expires=" + strconv.FormatInt(created.Add(s.expires).Unix(), 10)
+	}
+	if s.nonce {
+		b := make([]byte, 16)
+		rand.Read(b)
+		params += ";nonce=" + strconv.Quote(hex.EncodeToString(b))
+	}
+	params += ";keyid=" + strconv.Quote(s.keyID)
+	if len(s.tag) > 0 {
+		params += ";tag=" + strconv.Quote(s.tag)
+	}
+	base, err := signatureBase(req, s.components, params)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(base))
+	req.Header.Set("Signature-Input", s.label+"="+params)
+	req.Header.Set("Signature", s.label+"=:"+base64.StdEncoding.EncodeToString(mac.Sum(nil))+":")
+	return nil
+}
+
+//signatureBase of the covered components & the signature params (RFC 9421 2.5)
+func signatureBase(req *http.Request, components []string, params string) (string, error) {
+	b := &strings.Builder{}
+	for _, c := range components {
+		name := strings.ToLower(c)
+		v, err := signatureComponent(req, name)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(strconv.Quote(name) + ": " + v + "\n")
+	}
+	b.WriteString(`"@signature-params": ` + params)
+	return b.String(), nil
+}
+
+func signatureComponent(req *http.Request, name string) (string, error) {
+	scheme := req.URL.Scheme
+	if len(scheme) == 0 {
+		scheme = "http"
+		if req.TLS != nil {
+			scheme = "https"
+		}
+	}
+	authority := req.Host
+	if len(authority) == 0 {
+		authority = req.URL.Host
+	}
+	authority = strings.ToLower(authority)
+	if (scheme == "http" && strings.HasSuffix(authority, ":80")) || (scheme == "https" && strings.HasSuffix(authority, ":443")) {
+		authority = authority[:strings.LastIndex(authority, ":")]
+	}
+	path := req.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	switch name {
+	case "@method":
+		return req.Method, nil
+	case "@scheme":
+		return strings.ToLower(scheme), nil
+	case "@authority":
+		return authority, nil
+	case "@path":
+		return path, nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	case "@request-target":
+		if len(req.URL.RawQuery) > 0 {
+			return path + "?" + req.URL.RawQuery, nil
+		}
+		return path, nil
+	case "@target-uri":
+		uri := strings.ToLower(scheme) + "://" + authority + path
+		if len(req.URL.RawQuery) > 0 {
+			uri += "?" + req.URL.RawQuery
+		}
+		return uri, nil
+	}
+	if strings.HasPrefix(name, "@") {
+		return "", errors.Errorf("signature component %s unsupported", name)
+	}
+	values := req.Header.Values(name)
+	if len(values) == 0 {
+		return "", errors.Errorf("signature component %s missing", name)
+	}
+	for i, v := range values {
+		values[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(values, ", "), nil
+}
+
+//VerifyMessageSignature verify the hmac-sha256 message signatures of the request, eg. in a test server.
+//The key is looked up by the keyid, the Content-Digest covered is checked against the body.
+func VerifyMessageSignature(req *http.Request, key func(keyID string) ([]byte, error)) error {
+	inputs := splitMembers(req.Header.Get("Signature-Input"))
+	if len(inputs) == 0 {
+		return errors.Errorf("%w: Signature-Input missing", ErrInvalidSignature)
+	}
+	signatures := map[string]string{}
+	for _, m := range splitMembers(req.Header.Get("Signature")) {
+		if kv := strings.SplitN(m, "=", 2); len(kv) == 2 {
+			signatures[kv[0]] = strings.Trim(kv[1], ":")
+		}
+	}
+	for _, m := range inputs {
+		kv := strings.SplitN(m, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[1], "(") || !strings.Contains(kv[1], ")") {
+			return errors.Errorf("%w: Signature-Input %s malformed", ErrInvalidSignature, m)
+		}
+		label, params := kv[0], kv[1]
+		components := strings.Fields(params[1:strings.Index(params, ")")])
+		for i, c := range components {
+			components[i] = strings.Trim(c, `"`)
+		}
+		keyID := ""
+		for _, p := range strings.Split(params[strings.Index(params, ")")+1:], ";") {
+			if strings.HasPrefix(p, "keyid=") {
+				keyID, _ = strconv.Unquote(p[len("keyid="):])
+			}
+			if strings.HasPrefix(p, "expires=") {
+				if exp, err := strconv.ParseInt(p[len("expires="):], 10, 64); err == nil && time.Now().Unix() > exp {
+					return errors.Errorf("%w: %s expired", ErrInvalidSignature, label)
+				}
+			}
+		}
+		k, err := key(keyID)
+		if err != nil {
+			return err
+		}
+		for _, c := range components {
+			if c == "content-digest" {
+				if err := verifyContentDigest(req); err != nil {
+					return err
+				}
+			}
+		}
+		base, err := signatureBase(req, components, params)
+		if err != nil {
+			return errors.Errorf("%w: %s", ErrInvalidSignature, err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(signatures[label])
+		if err != nil {
+			return errors.Errorf("%w: %s signature malformed", ErrInvalidSignature, label)
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(base))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return errors.Errorf("%w: %s mismatch", ErrInvalidSignature, label)
+		}
+	}
+	return nil
+}
+
+func verifyContentDigest(req *http.Request) error {
+	if err := bufferBody(req); err != nil {
+		return err
+	}
+	for _, m := range splitMembers(req.Header.Get("Content-Digest")) {
+		if strings.HasPrefix(m, "sha-256=") {
+			sum, err := hashBody(req, sha256.New)
+			if err != nil {
+				return err
+			}
+			if strings.Trim(m[len("sha-256="):], ":") != base64.StdEncoding.EncodeToString(sum) {
+				return errors.Errorf("%w: Content-Digest mismatch", ErrInvalidSignature)
+			}
+			return nil
+		}
+	}
+	return errors.Errorf("%w: Content-Digest sha-256 missing", ErrInvalidSignature)
+}
+
+//splitMembers of a structured field dictionary by the commas outside quotes & parentheses
+func splitMembers(v string) []string {
+	members := []string{}
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '"' && (i == 0 || v[i-1] != '\\'):
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			if m := strings.TrimSpace(v[start:i]); len(m) > 0 {
+				members = append(members, m)
+			}
+			start = i + 1
+		}
+	}
+	if m := strings.TrimSpace(v[start:]); len(m) > 0 {
+		members = append(members, m)
+	}
+	return members
+}
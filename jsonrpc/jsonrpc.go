@@ -0,0 +1,263 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	json "github.com/json-iterator/go"
+	"github.com/x-mod/errors"
+	"github.com/x-mod/httpclient"
+)
+
+//error codes of the spec
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+)
+
+//DefaultResponseLimit max bytes of a jsonrpc response body, a larger one fails with a *httpclient.BodyTooLargeError
+var DefaultResponseLimit int64 = 32 << 20
+
+//ErrNoResponse the server didn't respond to a call of the batch
+var ErrNoResponse = errors.New("jsonrpc: no response")
+
+//Error object of the response
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+//Error implemention
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+//Value implemention of errors.Code
+func (e *Error) Value() int32 {
+	return int32(e.Code)
+}
+
+//String implemention of errors.Code
+func (e *Error) String() string {
+	return e.Message
+}
+
+//DecodeData decode the data of the error into obj
+func (e *Error) DecodeData(obj interface{}) error {
+	if len(e.Data) == 0 {
+		return errors.New("jsonrpc error without data")
+	}
+	return json.Unmarshal(e.Data, obj)
+}
+
+//Client json-rpc 2.0 client over http, requests go through httpclient.Client.Execute
+type Client struct {
+	client   *httpclient.Client
+	endpoint string
+	opts     []httpclient.ReqOpt
+	id       uint64
+}
+
+//Opt of jsonrpc client
+type Opt func(*Client)
+
+//RequestOpts opt, options applied to every json-rpc request, eg. headers
+func RequestOpts(opts ...httpclient.ReqOpt) Opt {
+	return func(c *Client) {
+		c.opts = append(c.opts, opts...)
+	}
+}
+
+//New jsonrpc client of the endpoint, the endpoint is resolved against the client's base url
+func New(client *httpclient.Client, endpoint string, opts ...Opt) *Client {
+	c := &Client{client: client, endpoint: endpoint}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+//Call of a batch
+type Call struct {
+	Method string
+	//Params by-position (slice) or by-name (struct or map), nil to omit
+	Params interface{}
+	//Result decode target of the result, nil to discard
+	Result interface{}
+	//Error of the call, a *Error when the server returns an error object
+	Error        error
+	id           *uint64
+	notification bool
+}
+
+//Batch of calls & notifications, sent in one request
+type Batch struct {
+	calls []*Call
+}
+
+//Call add a call to the batch
+func (b *Batch) Call(method string, params interface{}, result interface{}) *Call {
+	call := &Call{Method: method, Params: params, Result: result}
+	b.calls = append(b.calls, call)
+	return call
+}
+
+//Notify add a notification to the batch, the server doesn't respond to it
+func (b *Batch) Notify(method string, params interface{}) {
+	b.calls = append(b.calls, &Call{Method: method, Params: params, notification: true})
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *uint64     `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+//Call the method & decode the result into the target (nil to discard), a *Error is returned for the error object
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}, opts ...httpclient.ReqOpt) error {
+	call := &Call{Method: method, Params: params, Result: result, id: c.nextID()}
+	p := &processor{calls: map[string]*Call{idKey(*call.id): call}}
+	if err := c.execute(ctx, c.request(call), p, opts); err != nil {
+		return err
+	}
+	return call.Error
+}
+
+//Notify send the notification, no result is expected
+func (c *Client) Notify(ctx context.Context, method string, params interface{}, opts ...httpclient.ReqOpt) error {
+	return c.execute(ctx, c.request(&Call{Method: method, Params: params}), &processor{}, opts)
+}
+
+//Send the batch, the responses are matched to the calls by id regardless of their order.
+//It returns the error of the http request, the error of each call is set to Call.Error.
+func (c *Client) Send(ctx context.Context, batch *Batch, opts ...httpclient.ReqOpt) error {
+	if len(batch.calls) == 0 {
+		return errors.New("jsonrpc: empty batch")
+	}
+	reqs := make([]*request, 0, len(batch.calls))
+	p := &processor{calls: make(map[string]*Call)}
+	for _, call := range batch.calls {
+		call.Error = nil
+		if !call.notification {
+			call.id = c.nextID()
+			p.calls[idKey(*call.id)] = call
+		}
+		reqs = append(reqs, c.request(call))
+	}
+	return c.execute(ctx, reqs, p, opts)
+}
+
+func (c *Client) nextID() *uint64 {
+	id := atomic.AddUint64(&c.id, 1)
+	return &id
+}
+
+func (c *Client) request(call *Call) *request {
+	return &request{JSONRPC: "2.0", ID: call.id, Method: call.Method, Params: call.Params}
+}
+
+func (c *Client) execute(ctx context.Context, body interface{}, p *processor, opts []httpclient.ReqOpt) error {
+	reqOpts := append([]httpclient.ReqOpt{
+		httpclient.SetURL(c.endpoint),
+		httpclient.Method(http.MethodPost),
+		httpclient.Header("Accept", "application/json"),
+	}, c.opts...)
+	reqOpts = append(append(reqOpts, opts...), httpclient.Content(httpclient.JSON(body)))
+	req, err := c.client.MakeRequest(reqOpts...)
+	if err != nil {
+		return err
+	}
+	return c.client.Execute(ctx, req, httpclient.LimitBody(DefaultResponseLimit, p))
+}
+
+func idKey(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
+
+type processor struct {
+	calls map[string]*Call
+}
+
+//Process implemention of ResponseProcessor
+func (p *processor) Process(ctx context.Context, rsp *http.Response) error {
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	b = bytes.TrimSpace(b)
+	if len(p.calls) == 0 {
+		//notifications only
+		return httpclient.ExpectStatus().Process(ctx, replay(rsp, b))
+	}
+	responses := []*response{}
+	if len(b) > 0 && b[0] == '[' {
+		err = json.Unmarshal(b, &responses)
+	} else {
+		r := &response{}
+		err = json.Unmarshal(b, r)
+		responses = append(responses, r)
+	}
+	if err != nil || len(b) == 0 {
+		if serr := httpclient.ExpectStatus().Process(ctx, replay(rsp, b)); serr != nil {
+			return serr
+		}
+		if err == nil {
+			err = errors.New("empty body")
+		}
+		return errors.Annotate(err, "jsonrpc response decode")
+	}
+	for _, r := range responses {
+		key := strings.Trim(string(r.ID), `"`)
+		call, ok := p.calls[key]
+		if !ok {
+			//the error of an invalid batch or request, without id
+			if r.Error != nil && (len(key) == 0 || key == "null") {
+				for _, call := range p.calls {
+					if call.Error == nil {
+						call.Error = r.Error
+					}
+				}
+			}
+			continue
+		}
+		delete(p.calls, key)
+		if r.Error != nil {
+			call.Error = r.Error
+			continue
+		}
+		if call.Result != nil {
+			if err := json.Unmarshal(r.Result, call.Result); err != nil {
+				call.Error = errors.Annotate(err, "jsonrpc result decode")
+			}
+		}
+	}
+	for _, call := range p.calls {
+		if call.Error == nil {
+			call.Error = ErrNoResponse
+		}
+	}
+	return nil
+}
+
+func replay(rsp *http.Response, b []byte) *http.Response {
+	r := *rsp
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return &r
+}
@@ -0,0 +1,102 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/x-mod/httpclient"
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  []int           `json:"params"`
+}
+
+func TestClient(t *testing.T) {
+	notified := 0
+	handle := func(req rpcRequest) map[string]interface{} {
+		assert.Equal(t, "2.0", req.JSONRPC)
+		if req.ID == nil {
+			notified++
+			return nil
+		}
+		rsp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "add":
+			rsp["result"] = req.Params[0] + req.Params[1]
+		default:
+			rsp["error"] = map[string]interface{}{"code": MethodNotFound, "message": "Method not found", "data": req.Method}
+		}
+		return rsp
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var raw json.RawMessage
+		json.NewDecoder(r.Body).Decode(&raw)
+		if raw[0] == '[' {
+			reqs := []rpcRequest{}
+			json.Unmarshal(raw, &reqs)
+			rsps := []interface{}{}
+			//reversed order
+			for i := len(reqs) - 1; i >= 0; i-- {
+				if rsp := handle(reqs[i]); rsp != nil {
+					rsps = append(rsps, rsp)
+				}
+			}
+			json.NewEncoder(w).Encode(rsps)
+			return
+		}
+		req := rpcRequest{}
+		json.Unmarshal(raw, &req)
+		if rsp := handle(req); rsp != nil {
+			json.NewEncoder(w).Encode(rsp)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	client := New(httpclient.New(httpclient.BaseURL(ts.URL)), "/rpc")
+	sum := 0
+	assert.Nil(t, client.Call(context.TODO(), "add", []int{1, 2}, &sum))
+	assert.Equal(t, 3, sum)
+
+	err := client.Call(context.TODO(), "sub", []int{1, 2}, &sum)
+	rerr, ok := err.(*Error)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, MethodNotFound, rerr.Code)
+		method := ""
+		assert.Nil(t, rerr.DecodeData(&method))
+		assert.Equal(t, "sub", method)
+	}
+
+	assert.Nil(t, client.Notify(context.TODO(), "log", []int{1}))
+	assert.Equal(t, 1, notified)
+
+	batch := &Batch{}
+	a, b := 0, 0
+	c1 := batch.Call("add", []int{1, 1}, &a)
+	c2 := batch.Call("sub", []int{1, 1}, nil)
+	c3 := batch.Call("add", []int{2, 2}, &b)
+	batch.Notify("log", []int{2})
+	assert.Nil(t, client.Send(context.TODO(), batch))
+	assert.Nil(t, c1.Error)
+	assert.Nil(t, c3.Error)
+	assert.Equal(t, 2, a)
+	assert.Equal(t, 4, b)
+	_, ok = c2.Error.(*Error)
+	assert.True(t, ok)
+	assert.Equal(t, 2, notified)
+
+	limit := DefaultResponseLimit
+	DefaultResponseLimit = 8
+	assert.True(t, errors.Is(client.Send(context.TODO(), batch), httpclient.ErrBodyTooLarge))
+	DefaultResponseLimit = limit
+}
@@ -0,0 +1,204 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/x-mod/errors"
+)
+
+var (
+	//ErrBodyTooLarge the response body exceeds the limit, the error is a *BodyTooLargeError
+	ErrBodyTooLarge = errors.New("response body too large")
+	//ErrReadIdle no bytes of the response body arrived within the idle timeout
+	ErrReadIdle = errors.New("response body read idle")
+	//ErrReadTooSlow the response body arrived slower than the min rate
+	ErrReadTooSlow = errors.New("response body read too slow")
+)
+
+//BodyTooLargeError the response body exceeds the limit, matches ErrBodyTooLarge by errors.Is
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+//Error implemention
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("response body too large: exceeds %d bytes", e.Limit)
+}
+
+//Is ErrBodyTooLarge
+func (e *BodyTooLargeError) Is(target error) bool {
+	return target == ErrBodyTooLarge
+}
+
+type readConfig struct {
+	maxSize     int64
+	idleTimeout time.Duration
+	minRate     int64
+	rateWindow  time.Duration
+}
+
+//ReadOpt response body read limit
+type ReadOpt func(*readConfig)
+
+//MaxBodySize read at most size bytes of the response body, reading more fails with a *BodyTooLargeError, zero is unlimited
+func MaxBodySize(size int64) ReadOpt {
+	return func(cf *readConfig) {
+		cf.maxSize = size
+	}
+}
+
+//ReadIdleTimeout a read of the response body fails with ErrReadIdle if no bytes arrive within the timeout, zero is unlimited
+func ReadIdleTimeout(timeout time.Duration) ReadOpt {
+	return func(cf *readConfig) {
+		cf.idleTimeout = timeout
+	}
+}
+
+//MinReadRate reading the response body fails with ErrReadTooSlow if less than bytesPerSecond arrive,
+//the rate is measured per window of read time, so a slow processor isn't blamed on the server; zero rate is unlimited
+func MinReadRate(bytesPerSecond int64, window time.Duration) ReadOpt {
+	return func(cf *readConfig) {
+		cf.minRate = bytesPerSecond
+		cf.rateWindow = window
+	}
+}
+
+//ReadLimits opt, the read limits of every response body handed to the processors
+func ReadLimits(opts ...ReadOpt) Opt {
+	return func(cf *config) {
+		cf.readOpts = append(cf.readOpts, opts...)
+	}
+}
+
+//RequestReadLimits opt, the read limits of the response body, override the client's ReadLimits
+func RequestReadLimits(opts ...ReadOpt) ReqOpt {
+	return func(cf *requestConfig) {
+		cf.options.read = append(cf.options.read, opts...)
+	}
+}
+
+//guardBody wrap the response body with the read limits of the client & the request
+func (c *Client) guardBody(req *http.Request, body io.ReadCloser) io.ReadCloser {
+	opts := c.config.readOpts
+	if o := requestOptionsFrom(req.Context()); o != nil && len(o.read) > 0 {
+		opts = append(append([]ReadOpt{}, opts...), o.read...)
+	}
+	rc := readConfig{}
+	for _, opt := range opts {
+		opt(&rc)
+	}
+	if rc.maxSize <= 0 && rc.idleTimeout <= 0 && (rc.minRate <= 0 || rc.rateWindow <= 0) {
+		return body
+	}
+	return &guardedBody{ReadCloser: body, config: rc}
+}
+
+type guardedBody struct {
+	io.ReadCloser
+	config     readConfig
+	read       int64
+	windowRead int64
+	windowTime time.Duration
+	err        error
+	//timer the watchdog of the reads, reset per read
+	timer *time.Timer
+
+	mu       sync.Mutex
+	reading  bool
+	deadline time.Time
+	//kind of the watchdog, ErrReadIdle or ErrReadTooSlow
+	kind    error
+	expired error
+}
+
+func (g *guardedBody) Read(p []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.config.maxSize > 0 && int64(len(p)) > g.config.maxSize-g.read+1 {
+		p = p[:g.config.maxSize-g.read+1]
+	}
+	//the watchdog closes the body to unblock the read
+	d, kind := g.watchdog()
+	if d > 0 {
+		g.mu.Lock()
+		g.reading, g.deadline, g.kind = true, time.Now().Add(d), kind
+		g.mu.Unlock()
+		if g.timer == nil {
+			g.timer = time.AfterFunc(d, g.expire)
+		} else {
+			g.timer.Reset(d)
+		}
+	}
+	start := time.Now()
+	n, err := g.ReadCloser.Read(p)
+	elapsed := time.Since(start)
+	if d > 0 {
+		fired := !g.timer.Stop()
+		g.mu.Lock()
+		g.reading = false
+		expired := g.expired
+		g.mu.Unlock()
+		if fired && expired != nil {
+			g.err = expired
+			//the read completed before the body was closed, the next one fails
+			if n > 0 && err == nil {
+				return n, nil
+			}
+			return n, g.err
+		}
+	}
+	g.read += int64(n)
+	if g.config.maxSize > 0 && g.read > g.config.maxSize {
+		g.err = &BodyTooLargeError{Limit: g.config.maxSize}
+		return n - int(g.read-g.config.maxSize), g.err
+	}
+	if g.config.minRate > 0 && g.config.rateWindow > 0 {
+		g.windowRead += int64(n)
+		g.windowTime += elapsed
+		if g.windowTime >= g.config.rateWindow {
+			if g.windowRead*int64(time.Second) < g.config.minRate*int64(g.windowTime) {
+				g.err = errors.Errorf("%w: %d bytes in %s", ErrReadTooSlow, g.windowRead, g.windowTime)
+				return n, g.err
+			}
+			g.windowRead, g.windowTime = 0, 0
+		}
+	}
+	return n, err
+}
+
+//watchdog delay & kind of the blocked read, the idle timeout or the end of the rate window without enough bytes
+func (g *guardedBody) watchdog() (time.Duration, error) {
+	var d time.Duration
+	var kind error
+	if g.config.idleTimeout > 0 {
+		d, kind = g.config.idleTimeout, ErrReadIdle
+	}
+	if g.config.minRate > 0 && g.config.rateWindow > 0 {
+		need := g.config.minRate * int64(g.config.rateWindow) / int64(time.Second)
+		if remain := g.config.rateWindow - g.windowTime; g.windowRead < need && (d == 0 || remain < d) {
+			d, kind = remain, ErrReadTooSlow
+		}
+	}
+	return d, kind
+}
+
+//expire the blocked read, a late timer of a returned read is ignored
+func (g *guardedBody) expire() {
+	g.mu.Lock()
+	if !g.reading || g.expired != nil || time.Now().Before(g.deadline) {
+		g.mu.Unlock()
+		return
+	}
+	if g.kind == ErrReadIdle {
+		g.expired = errors.Errorf("%w: no bytes within %s", ErrReadIdle, g.config.idleTimeout)
+	} else {
+		g.expired = errors.Errorf("%w: %d bytes in %s", ErrReadTooSlow, g.windowRead, g.config.rateWindow)
+	}
+	g.mu.Unlock()
+	g.ReadCloser.Close()
+}
@@ -0,0 +1,438 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/json-iterator/go"
+	"github.com/x-mod/errors"
+)
+
+//DefaultExpirySkew a token is refreshed this long before it expires
+var DefaultExpirySkew = 10 * time.Second
+
+//Token of oauth2
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	//Expiry zero if the token doesn't expire
+	Expiry time.Time
+	Scope  string
+	//Raw the token response
+	Raw map[string]interface{}
+}
+
+//Type token type of the Authorization header, Bearer by default
+func (t *Token) Type() string {
+	if len(t.TokenType) == 0 || strings.EqualFold(t.TokenType, "bearer") {
+		return "Bearer"
+	}
+	return t.TokenType
+}
+
+func (t *Token) valid(skew time.Duration) bool {
+	return t != nil && len(t.AccessToken) > 0 && (t.Expiry.IsZero() || time.Now().Add(skew).Before(t.Expiry))
+}
+
+//OAuth2Error error response of the token endpoint (RFC 6749 5.2)
+type OAuth2Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	URI         string `json:"error_uri"`
+	StatusCode  int    `json:"-"`
+}
+
+//Error implemention
+func (e *OAuth2Error) Error() string {
+	if len(e.Description) > 0 {
+		return fmt.Sprintf("oauth2 %s: %s", e.Code, e.Description)
+	}
+	return "oauth2 " + e.Code
+}
+
+//Value implemention of errors.Code
+func (e *OAuth2Error) Value() int32 {
+	return int32(e.StatusCode)
+}
+
+//String implemention of errors.Code
+func (e *OAuth2Error) String() string {
+	return e.Code
+}
+
+//TokenSource oauth2 token source, the token is cached until shortly before it expires,
+//& fetched once for the concurrent callers
+type TokenSource struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	grant        func(s *TokenSource) (url.Values, error)
+	scopes       []string
+	params       url.Values
+	inBody       bool
+	skew         time.Duration
+	client       *Client
+	//jwt bearer
+	issuer   string
+	subject  string
+	audience string
+	keyID    string
+	key      interface{}
+
+	mu           sync.Mutex
+	token        *Token
+	refreshToken string
+	call         *tokenCall
+}
+
+type tokenCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+//OAuth2Opt option of TokenSource
+type OAuth2Opt func(*TokenSource)
+
+//Scopes opt, the scopes requested
+func Scopes(scopes ...string) OAuth2Opt {
+	return func(s *TokenSource) {
+		s.scopes = append(s.scopes, scopes...)
+	}
+}
+
+//TokenParam opt, an extra param of the token request, eg. audience or resource
+func TokenParam(name string, value string) OAuth2Opt {
+	return func(s *TokenSource) {
+		s.params.Add(name, value)
+	}
+}
+
+//ClientSecretInBody opt, send the client credentials in the form (client_secret_post) instead of basic auth
+func ClientSecretInBody(flag bool) OAuth2Opt {
+	return func(s *TokenSource) {
+		s.inBody = flag
+	}
+}
+
+//ExpirySkew opt, DefaultExpirySkew by default
+func ExpirySkew(skew time.Duration) OAuth2Opt {
+	return func(s *TokenSource) {
+		s.skew = skew
+	}
+}
+
+//TokenClient opt, the client requesting the token endpoint, a default client by default
+func TokenClient(client *Client) OAuth2Opt {
+	return func(s *TokenSource) {
+		s.client = client
+	}
+}
+
+//Audience opt of JWTBearer, the aud claim, the token url by default
+func Audience(audience string) OAuth2Opt {
+	return func(s *TokenSource) {
+		s.audience = audience
+	}
+}
+
+//KeyID opt of JWTBearer, the kid header
+func KeyID(kid string) OAuth2Opt {
+	return func(s *TokenSource) {
+		s.keyID = kid
+	}
+}
+
+func newTokenSource(tokenURL string, clientID string, clientSecret string, opts []OAuth2Opt) *TokenSource {
+	s := &TokenSource{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		params:       make(url.Values),
+		skew:         DefaultExpirySkew,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.client == nil {
+		s.client = New()
+	}
+	return s
+}
+
+//ClientCredentials token source of the client credentials grant (RFC 6749 4.4)
+func ClientCredentials(tokenURL string, clientID string, clientSecret string, opts ...OAuth2Opt) *TokenSource {
+	s := newTokenSource(tokenURL, clientID, clientSecret, opts)
+	s.grant = func(s *TokenSource) (url.Values, error) {
+		return url.Values{"grant_type": {"client_credentials"}}, nil
+	}
+	return s
+}
+
+//RefreshToken token source of the refresh token grant (RFC 6749 6), a rotated refresh token is kept for the next refresh
+func RefreshToken(tokenURL string, clientID string, clientSecret string, refreshToken string, opts ...OAuth2Opt) *TokenSource {
+	s := newTokenSource(tokenURL, clientID, clientSecret, opts)
+	s.refreshToken = refreshToken
+	s.grant = func(s *TokenSource) (url.Values, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return url.Values{"grant_type": {"refresh_token"}, "refresh_token": {s.refreshToken}}, nil
+	}
+	return s
+}
+
+//JWTBearer token source of the jwt bearer grant (RFC 7523), the assertion is signed by the key:
+//*rsa.PrivateKey (RS256), *ecdsa.PrivateKey (ES256, P-256) or []byte (HS256)
+func JWTBearer(tokenURL string, issuer string, subject string, key interface{}, opts ...OAuth2Opt) *TokenSource {
+	s := newTokenSource(tokenURL, "", "", opts)
+	s.issuer, s.subject, s.key = issuer, subject, key
+	s.grant = func(s *TokenSource) (url.Values, error) {
+		assertion, err := s.assertion()
+		if err != nil {
+			return nil, err
+		}
+		return url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}, nil
+	}
+	return s
+}
+
+//Token the cached token, or a new one from the token endpoint
+func (s *TokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	if s.token.valid(s.skew) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	call := s.call
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		s.call = call
+		//not bound to the first caller's context, the other callers wait for it too
+		go s.fetch(call)
+	}
+	s.mu.Unlock()
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+//Invalidate the cached token, if it's still the token
+func (s *TokenSource) Invalidate(token *Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = nil
+	}
+}
+
+func (s *TokenSource) fetch(call *tokenCall) {
+	call.token, call.err = s.request(context.Background())
+	s.mu.Lock()
+	if call.err == nil {
+		s.token = call.token
+		if len(call.token.RefreshToken) > 0 {
+			s.refreshToken = call.token.RefreshToken
+		}
+	}
+	s.call = nil
+	s.mu.Unlock()
+	close(call.done)
+}
+
+func (s *TokenSource) request(ctx context.Context) (*Token, error) {
+	form, err := s.grant(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.scopes) > 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+	for k, v := range s.params {
+		form[k] = v
+	}
+	opts := []ReqOpt{
+		Method(http.MethodPost),
+		SetURL(s.tokenURL),
+		Header("Accept", "application/json"),
+	}
+	if len(s.clientID) > 0 {
+		if s.inBody {
+			form.Set("client_id", s.clientID)
+			form.Set("client_secret", s.clientSecret)
+		} else {
+			opts = append(opts, BasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret)))
+		}
+	}
+	req, err := s.client.MakeRequest(append(opts, Content(Form(form)))...)
+	if err != nil {
+		return nil, err
+	}
+	token := &Token{}
+	if err := s.client.Execute(ctx, req, ResponseProcessorFunc(func(ctx context.Context, rsp *http.Response) error {
+		return decodeToken(rsp, token)
+	})); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func decodeToken(rsp *http.Response, token *Token) error {
+	b, err := ioutil.ReadAll(io.LimitReader(rsp.Body, maxProblemBody))
+	if err != nil {
+		return err
+	}
+	if !success(rsp) {
+		oerr := &OAuth2Error{StatusCode: rsp.StatusCode}
+		if json.Unmarshal(b, oerr) == nil && len(oerr.Code) > 0 {
+			return oerr
+		}
+		r := *rsp
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		return responseError(&r)
+	}
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return errors.Annotate(err, "oauth2 token response decode")
+	}
+	token.Raw = raw
+	token.AccessToken, _ = raw["access_token"].(string)
+	token.TokenType, _ = raw["token_type"].(string)
+	token.RefreshToken, _ = raw["refresh_token"].(string)
+	token.Scope, _ = raw["scope"].(string)
+	if len(token.AccessToken) == 0 {
+		return errors.New("oauth2 token response without access_token")
+	}
+	var expiresIn int64
+	switch v := raw["expires_in"].(type) {
+	case float64:
+		expiresIn = int64(v)
+	case string:
+		expiresIn, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if expiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	return nil
+}
+
+//assertion the signed jwt of the jwt bearer grant
+func (s *TokenSource) assertion() (string, error) {
+	alg := ""
+	switch s.key.(type) {
+	case *rsa.PrivateKey:
+		alg = "RS256"
+	case *ecdsa.PrivateKey:
+		alg = "ES256"
+	case []byte:
+		alg = "HS256"
+	default:
+		return "", errors.Errorf("jwt bearer key %T unsupported", s.key)
+	}
+	header := map[string]interface{}{"alg": alg, "typ": "JWT"}
+	if len(s.keyID) > 0 {
+		header["kid"] = s.keyID
+	}
+	audience := s.audience
+	if len(audience) == 0 {
+		audience = s.tokenURL
+	}
+	now := time.Now()
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	claims := map[string]interface{}{
+		"iss": s.issuer,
+		"sub": s.subject,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+		"jti": hex.EncodeToString(jti),
+	}
+	hb, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	cb, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signing := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(cb)
+	sum := sha256.Sum256([]byte(signing))
+	var sig []byte
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:]); err != nil {
+			return "", err
+		}
+	case *ecdsa.PrivateKey:
+		r, ss, err := ecdsa.Sign(rand.Reader, key, sum[:])
+		if err != nil {
+			return "", err
+		}
+		sig = append(padInt(r, 32), padInt(ss, 32)...)
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signing))
+		sig = mac.Sum(nil)
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func padInt(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+//Authenticate implemention of Authenticator
+func (s *TokenSource) Authenticate(ctx context.Context, req *http.Request) error {
+	token, err := s.Token(ctx)
+	if err != nil {
+		return errors.Errorf("oauth2 token: %w", err)
+	}
+	req.Header.Set("Authorization", token.Type()+" "+token.AccessToken)
+	return nil
+}
+
+//HandleChallenge implemention of ChallengeHandler, the token of the request is revoked or expired early,
+//it's invalidated & the request is retried with a fresh one
+func (s *TokenSource) HandleChallenge(ctx context.Context, req *http.Request, rsp *http.Response) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && req.Header.Get("Authorization") == s.token.Type()+" "+s.token.AccessToken {
+		s.token = nil
+	}
+	return true, nil
+}
+
+//OAuth2 opt, authorize the requests by the tokens of the source; on a 401 response the token is invalidated
+//& the request is sent once more with a fresh token. Requests with an Authorization of their own are left untouched.
+func OAuth2(source *TokenSource) Opt {
+	return Authentication(source)
+}
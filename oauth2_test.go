@@ -0,0 +1,118 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuth2(t *testing.T) {
+	var issued int32
+	valid := sync.Map{}
+	refresh := "r-0"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api" {
+			if _, ok := valid.Load(r.Header.Get("Authorization")); !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{}`))
+			return
+		}
+		r.ParseForm()
+		n := atomic.AddInt32(&issued, 1)
+		token := fmt.Sprintf("t-%d", n)
+		rsp := map[string]interface{}{"access_token": token, "token_type": "bearer", "expires_in": "3600"}
+		switch r.PostForm.Get("grant_type") {
+		case "client_credentials":
+			if id, secret, _ := r.BasicAuth(); id != "id" || secret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"invalid_client","error_description":"bad secret"}`))
+				return
+			}
+			assert.Equal(t, "read write", r.PostForm.Get("scope"))
+			time.Sleep(20 * time.Millisecond)
+		case "refresh_token":
+			assert.Equal(t, refresh, r.PostForm.Get("refresh_token"))
+			refresh = fmt.Sprintf("r-%d", n)
+			rsp["refresh_token"] = refresh
+		case "urn:ietf:params:oauth:grant-type:jwt-bearer":
+			parts := strings.Split(r.PostForm.Get("assertion"), ".")
+			mac := hmac.New(sha256.New, []byte("key"))
+			mac.Write([]byte(parts[0] + "." + parts[1]))
+			assert.Equal(t, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2])
+			claims := map[string]interface{}{}
+			b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			json.Unmarshal(b, &claims)
+			assert.Equal(t, "issuer", claims["iss"])
+			assert.Equal(t, "https://as.example.com", claims["aud"])
+		}
+		valid.Store("Bearer "+token, true)
+		json.NewEncoder(w).Encode(rsp)
+	}))
+	defer ts.Close()
+
+	get := func(client *Client) error {
+		req, err := client.MakeRequest(SetURL("/api"))
+		if err != nil {
+			return err
+		}
+		return client.Execute(context.TODO(), req, ExpectStatus())
+	}
+
+	//the concurrent requests share one token
+	source := ClientCredentials(ts.URL+"/token", "id", "secret", Scopes("read", "write"))
+	client := New(BaseURL(ts.URL), OAuth2(source))
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, get(client))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&issued))
+
+	//revoked token, retried once with a fresh one
+	valid.Delete("Bearer t-1")
+	assert.Nil(t, get(client))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&issued))
+
+	//token endpoint error
+	err := get(New(BaseURL(ts.URL), OAuth2(ClientCredentials(ts.URL+"/token", "id", "wrong"))))
+	oerr := &OAuth2Error{}
+	if assert.True(t, errors.As(err, &oerr)) {
+		assert.Equal(t, "invalid_client", oerr.Code)
+		assert.Equal(t, http.StatusUnauthorized, oerr.StatusCode)
+	}
+
+	//refresh token rotation
+	source = RefreshToken(ts.URL+"/token", "id", "secret", "r-0")
+	token, err := source.Token(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer", token.Type())
+	assert.True(t, token.Expiry.After(time.Now().Add(time.Hour-time.Minute)))
+	source.Invalidate(token)
+	next, err := source.Token(context.TODO())
+	assert.Nil(t, err)
+	assert.NotEqual(t, token.AccessToken, next.AccessToken)
+
+	//jwt bearer
+	client = New(BaseURL(ts.URL), OAuth2(JWTBearer(ts.URL+"/token", "issuer", "subject", []byte("key"), Audience("https://as.example.com"))))
+	assert.Nil(t, get(client))
+}
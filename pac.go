@@ -0,0 +1,457 @@
+package httpclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertkrimen/otto"
+	"github.com/x-mod/errors"
+)
+
+//DefaultPACRetryAfter default time a failed proxy of the PAC list is skipped
+var DefaultPACRetryAfter = time.Minute
+
+//DefaultPACEvalTimeout max time of a FindProxyForURL evaluation, the script is interrupted after it
+var DefaultPACEvalTimeout = 5 * time.Second
+
+//pacUtils the standard helper functions of the PAC scripts, dnsResolve & myIpAddress are native
+const pacUtils = `
+function isPlainHostName(host) {
+	return String(host).indexOf('.') < 0;
+}
+function dnsDomainIs(host, domain) {
+	host = String(host).toLowerCase();
+	domain = String(domain).toLowerCase();
+	return host.length >= domain.length && host.substring(host.length - domain.length) == domain;
+}
+function localHostOrDomainIs(host, hostdom) {
+	host = String(host).toLowerCase();
+	hostdom = String(hostdom).toLowerCase();
+	return host == hostdom || hostdom.lastIndexOf(host + '.', 0) == 0;
+}
+function isResolvable(host) {
+	return dnsResolve(host) != null;
+}
+function dnsDomainLevels(host) {
+	return String(host).split('.').length - 1;
+}
+function convert_addr(ipchars) {
+	var b = String(ipchars).split('.');
+	return ((b[0] & 0xff) << 24) | ((b[1] & 0xff) << 16) | ((b[2] & 0xff) << 8) | (b[3] & 0xff);
+}
+function isInNet(ipaddr, pattern, maskstr) {
+	var ipv4 = /^\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}$/;
+	if (!ipv4.test(ipaddr)) {
+		ipaddr = dnsResolve(ipaddr);
+		if (ipaddr == null) {
+			return false;
+		}
+	}
+	if (!ipv4.test(pattern) || !ipv4.test(maskstr)) {
+		return false;
+	}
+	var mask = convert_addr(maskstr);
+	return (convert_addr(ipaddr) & mask) == (convert_addr(pattern) & mask);
+}
+function shExpMatch(str, shexp) {
+	var re = '';
+	shexp = String(shexp);
+	for (var i = 0; i < shexp.length; i++) {
+		var c = shexp.charAt(i);
+		if (c == '*') {
+			re += '.*';
+		} else if (c == '?') {
+			re += '.';
+		} else if ('\\^$.|+()[]{}'.indexOf(c) >= 0) {
+			re += '\\' + c;
+		} else {
+			re += c;
+		}
+	}
+	return new RegExp('^' + re + '$').test(str);
+}
+var __days = ['SUN', 'MON', 'TUE', 'WED', 'THU', 'FRI', 'SAT'];
+var __months = ['JAN', 'FEB', 'MAR', 'APR', 'MAY', 'JUN', 'JUL', 'AUG', 'SEP', 'OCT', 'NOV', 'DEC'];
+function __args(args) {
+	var a = Array.prototype.slice.call(args);
+	var gmt = a.length > 0 && a[a.length - 1] === 'GMT';
+	if (gmt) {
+		a.pop();
+	}
+	var d = new Date();
+	var now = gmt ?
+		{day: d.getUTCDay(), date: d.getUTCDate(), month: d.getUTCMonth(), year: d.getUTCFullYear(), sec: d.getUTCHours() * 3600 + d.getUTCMinutes() * 60 + d.getUTCSeconds()} :
+		{day: d.getDay(), date: d.getDate(), month: d.getMonth(), year: d.getFullYear(), sec: d.getHours() * 3600 + d.getMinutes() * 60 + d.getSeconds()};
+	return {args: a, now: now};
+}
+function __inRange(v, a, b) {
+	return a <= b ? v >= a && v <= b : v >= a || v <= b;
+}
+function weekdayRange() {
+	var p = __args(arguments);
+	var a = __days.indexOf(String(p.args[0]).toUpperCase());
+	var b = p.args.length > 1 ? __days.indexOf(String(p.args[1]).toUpperCase()) : a;
+	return a >= 0 && b >= 0 && __inRange(p.now.day, a, b);
+}
+function dateRange() {
+	var p = __args(arguments);
+	var parsed = [];
+	for (var i = 0; i < p.args.length; i++) {
+		var v = p.args[i];
+		var m = __months.indexOf(String(v).toUpperCase());
+		if (m >= 0) {
+			parsed.push({kind: 'month', value: m});
+		} else if (Number(v) > 31) {
+			parsed.push({kind: 'year', value: Number(v)});
+		} else {
+			parsed.push({kind: 'date', value: Number(v)});
+		}
+	}
+	var half = parsed.length == 1 ? 1 : parsed.length / 2;
+	var key = function(items, now) {
+		var fields = {year: 10000, month: 100, date: 1};
+		var k = 0;
+		for (var i = 0; i < items.length; i++) {
+			k += fields[items[i].kind] * (now ? p.now[items[i].kind] : items[i].value);
+		}
+		return k;
+	};
+	var from = parsed.slice(0, half);
+	var to = parsed.length == 1 ? from : parsed.slice(half);
+	return __inRange(key(from, true), key(from, false), key(to, false));
+}
+function timeRange() {
+	var p = __args(arguments);
+	var a = p.args, from, to;
+	switch (a.length) {
+	case 1:
+		from = a[0] * 3600;
+		to = from + 3599;
+		break;
+	case 2:
+		from = a[0] * 3600;
+		to = a[1] * 3600 - 1;
+		break;
+	case 4:
+		from = a[0] * 3600 + a[1] * 60;
+		to = a[2] * 3600 + a[3] * 60 - 1;
+		break;
+	case 6:
+		from = a[0] * 3600 + a[1] * 60 + a[2];
+		to = a[3] * 3600 + a[4] * 60 + a[5];
+		break;
+	default:
+		return false;
+	}
+	return __inRange(p.now.sec, from, to);
+}
+function alert(msg) {
+}
+`
+
+type pacScript struct {
+	location string
+	client   *http.Client
+
+	mu      sync.Mutex
+	vm      *otto.Otto
+	loading chan struct{}
+	err     error
+	retryAt time.Time
+	cache   map[string][]*url.URL
+	bad     map[string]time.Time
+
+	//evalMu serialize the evaluations, the vm isn't goroutine safe
+	evalMu  sync.Mutex
+	evalCtx context.Context
+}
+
+//PAC opt, select the proxies by the proxy auto-config script of the url or file, after the rules.
+//FindProxyForURL is evaluated once per host, by the url of the first request to it, the proxies of the result
+//"PROXY a:3128; SOCKS b:1080; DIRECT" are tried in order, a proxy failed to connect is skipped for DefaultPACRetryAfter.
+//The script is loaded once at the first request, by the client's tls config & dialer without the proxies,
+//a failed load fails the requests with a *ProxyError & is retried after DefaultPACRetryAfter.
+//An evaluation is interrupted when the request's context is done or after DefaultPACEvalTimeout,
+//failing the request with a *ProxyError.
+func PAC(location string) ProxyOpt {
+	return func(pc *proxyConfig) {
+		pc.pac = &pacScript{
+			location: location,
+			client:   &http.Client{Transport: &http.Transport{}, Timeout: DefaultClientTimeout},
+			cache:    make(map[string][]*url.URL),
+			bad:      make(map[string]time.Time),
+		}
+	}
+}
+
+//script the loaded vm, the script is loaded once by the first caller & waited by the others within their contexts
+func (p *pacScript) script(ctx context.Context) (*otto.Otto, error) {
+	p.mu.Lock()
+	if p.vm != nil {
+		vm := p.vm
+		p.mu.Unlock()
+		return vm, nil
+	}
+	if p.err != nil && time.Now().Before(p.retryAt) {
+		err := p.err
+		p.mu.Unlock()
+		return nil, err
+	}
+	loading := p.loading
+	if loading == nil {
+		loading = make(chan struct{})
+		p.loading = loading
+		go func() {
+			vm, err := p.load()
+			p.mu.Lock()
+			p.vm, p.err, p.loading = vm, err, nil
+			if err != nil {
+				p.retryAt = time.Now().Add(DefaultPACRetryAfter)
+			}
+			p.mu.Unlock()
+			close(loading)
+		}()
+	}
+	p.mu.Unlock()
+	select {
+	case <-loading:
+	case <-ctx.Done():
+		return nil, errors.Annotate(ctx.Err(), "pac load")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.vm, p.err
+}
+
+//load the script
+func (p *pacScript) load() (*otto.Otto, error) {
+	var script []byte
+	var err error
+	if strings.HasPrefix(p.location, "http://") || strings.HasPrefix(p.location, "https://") {
+		var rsp *http.Response
+		if rsp, err = p.client.Get(p.location); err != nil {
+			return nil, errors.Annotate(err, "pac load")
+		}
+		defer rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("pac load %s: %s", p.location, rsp.Status)
+		}
+		script, err = ioutil.ReadAll(rsp.Body)
+	} else {
+		script, err = ioutil.ReadFile(strings.TrimPrefix(p.location, "file://"))
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "pac load")
+	}
+	vm := otto.New()
+	vm.Set("dnsResolve", func(call otto.FunctionCall) otto.Value {
+		ctx := p.evalCtx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if ip := resolveIPv4(ctx, call.Argument(0).String()); len(ip) > 0 {
+			v, _ := otto.ToValue(ip)
+			return v
+		}
+		return otto.NullValue()
+	})
+	vm.Set("myIpAddress", func(call otto.FunctionCall) otto.Value {
+		v, _ := otto.ToValue(localIPv4())
+		return v
+	})
+	if _, err := vm.Run(pacUtils); err != nil {
+		return nil, errors.Annotate(err, "pac utils")
+	}
+	if _, err := vm.Run(string(script)); err != nil {
+		return nil, errors.Annotatef(err, "pac script %s", p.location)
+	}
+	return vm, nil
+}
+
+//pacURL the url given to FindProxyForURL, without the userinfo, the fragment & the default port
+func pacURL(target *url.URL) string {
+	u := *target
+	u.User, u.Fragment = nil, ""
+	if port := u.Port(); (port == "80" && u.Scheme == "http") || (port == "443" && u.Scheme == "https") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	return u.String()
+}
+
+//proxies of the url's host, nil for direct
+func (p *pacScript) proxies(ctx context.Context, target *url.URL) ([]*url.URL, error) {
+	host := strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+	p.mu.Lock()
+	proxies, ok := p.cache[host]
+	p.mu.Unlock()
+	if ok {
+		return proxies, nil
+	}
+	vm, err := p.script(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := p.eval(ctx, vm, target, host)
+	if err != nil {
+		return nil, err
+	}
+	proxies = parsePACResult(result)
+	p.mu.Lock()
+	p.cache[host] = proxies
+	p.mu.Unlock()
+	return proxies, nil
+}
+
+//pacInterrupt the panic interrupting the vm
+type pacInterrupt struct {
+	err error
+}
+
+//eval FindProxyForURL of the url, the vm is interrupted when the context is done or after DefaultPACEvalTimeout
+func (p *pacScript) eval(ctx context.Context, vm *otto.Otto, target *url.URL, host string) (result string, err error) {
+	p.evalMu.Lock()
+	defer p.evalMu.Unlock()
+	//a new channel per evaluation, a late interrupt is dropped with the channel
+	interrupt := make(chan func(), 1)
+	vm.Interrupt = interrupt
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		timer := time.NewTimer(DefaultPACEvalTimeout)
+		defer timer.Stop()
+		var cause error
+		select {
+		case <-ctx.Done():
+			cause = ctx.Err()
+		case <-timer.C:
+			cause = errors.Errorf("timeout after %s", DefaultPACEvalTimeout)
+		case <-stop:
+			return
+		}
+		interrupt <- func() {
+			panic(&pacInterrupt{err: cause})
+		}
+	}()
+	p.evalCtx = ctx
+	defer func() {
+		p.evalCtx = nil
+		if caught := recover(); caught != nil {
+			pi, ok := caught.(*pacInterrupt)
+			if !ok {
+				panic(caught)
+			}
+			err = errors.Errorf("pac FindProxyForURL %s interrupted: %w", host, pi.err)
+		}
+	}()
+	v, err := vm.Call("FindProxyForURL", nil, pacURL(target), host)
+	if err != nil {
+		return "", errors.Annotatef(err, "pac FindProxyForURL %s", host)
+	}
+	return v.String(), nil
+}
+
+//parsePACResult the proxies of the result, nil for DIRECT, DIRECT if none is supported
+func parsePACResult(result string) []*url.URL {
+	proxies := []*url.URL{}
+	for _, item := range strings.Split(result, ";") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		scheme := ""
+		switch strings.ToUpper(fields[0]) {
+		case "DIRECT":
+			proxies = append(proxies, nil)
+			continue
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5h"
+		default:
+			continue
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		proxies = append(proxies, &url.URL{Scheme: scheme, Host: fields[1]})
+	}
+	if len(proxies) == 0 {
+		proxies = append(proxies, nil)
+	}
+	return proxies
+}
+
+//route of the url, the first proxy not failed recently, or the first at all
+func (p *pacScript) route(ctx context.Context, target *url.URL) (*url.URL, error) {
+	proxies, err := p.proxies(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, u := range proxies {
+		if u == nil || time.Now().After(p.bad[u.String()]) {
+			return u, nil
+		}
+	}
+	return proxies[0], nil
+}
+
+//failover mark the proxy of the url failed, true if there is another to try
+func (p *pacScript) failover(ctx context.Context, target *url.URL) bool {
+	u, err := p.route(ctx, target)
+	if err != nil || u == nil {
+		return false
+	}
+	p.mu.Lock()
+	p.bad[u.String()] = time.Now().Add(DefaultPACRetryAfter)
+	p.mu.Unlock()
+	next, err := p.route(ctx, target)
+	return err == nil && (next == nil || next.String() != u.String())
+}
+
+//attempt do the request once, again by the next proxy of the PAC script if the proxy failed to connect
+func (c *Client) attempt(ctx context.Context, req *http.Request, tc timeoutConfig) (*http.Response, error) {
+	for {
+		rsp, err := c.attemptOnce(ctx, req, tc)
+		if err == nil || ctx.Err() != nil || c.config.proxies == nil || !replayable(req) || !c.config.proxies.failover(req, err) {
+			return rsp, err
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func resolveIPv4(ctx context.Context, host string) string {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return addr.IP.String()
+		}
+	}
+	return ""
+}
+
+func localIPv4() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+				return ipnet.IP.String()
+			}
+		}
+	}
+	return "127.0.0.1"
+}
@@ -0,0 +1,256 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	json "github.com/json-iterator/go"
+	"github.com/x-mod/errors"
+)
+
+//ErrStopPagination returned by the page processor to stop paginating without error
+var ErrStopPagination = errors.New("stop pagination")
+
+//Page response of a pagination
+type Page struct {
+	//Number of the page, from 1
+	Number   int
+	Request  *http.Request
+	Response *http.Response
+	//Body of the response, buffered
+	Body []byte
+}
+
+//Pagination strategy
+type Pagination interface {
+	//Next options of the next page request, appended to the builder's options; page is nil before the first request.
+	//more is false when the pages are exhausted.
+	Next(page *Page) (opts []ReqOpt, more bool, err error)
+}
+
+//PaginationFunc custom pagination strategy
+type PaginationFunc func(page *Page) ([]ReqOpt, bool, error)
+
+//Next implemention of Pagination
+func (f PaginationFunc) Next(page *Page) ([]ReqOpt, bool, error) {
+	return f(page)
+}
+
+type paginator struct {
+	maxPages int
+}
+
+//PaginateOpt option of Paginate
+type PaginateOpt func(*paginator)
+
+//MaxPages stop after max pages, unlimited by default
+func MaxPages(max int) PaginateOpt {
+	return func(p *paginator) {
+		p.maxPages = max
+	}
+}
+
+//Paginate request the pages one by one & invoke the processor per page, until the pagination is exhausted,
+//the max pages reached, the context done or the processor returns ErrStopPagination.
+//Every page request is built afresh from the builder's options, plus the options of the pagination.
+func (c *Client) Paginate(ctx context.Context, builder *RequestBuilder, pagination Pagination, processor ResponseProcessor, opts ...PaginateOpt) error {
+	pg := &paginator{}
+	for _, opt := range opts {
+		opt(pg)
+	}
+	next, more, err := pagination.Next(nil)
+	if err != nil || !more {
+		return err
+	}
+	for n := 1; pg.maxPages <= 0 || n <= pg.maxPages; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		req, err := c.MakeRequest(append(builder.Options(), next...)...)
+		if err != nil {
+			return err
+		}
+		page, err := c.page(ctx, n, req)
+		if err != nil {
+			return err
+		}
+		if processor != nil {
+			rsp := *page.Response
+			rsp.Body = ioutil.NopCloser(bytes.NewReader(page.Body))
+			if err := processor.Process(withCodecs(ctx, c.config.codecs), &rsp); err != nil {
+				if err == ErrStopPagination {
+					return nil
+				}
+				return err
+			}
+		}
+		if next, more, err = pagination.Next(page); err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) page(ctx context.Context, n int, req *http.Request) (*Page, error) {
+	rsp, err := c.execute(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer drainBody(rsp.Body)
+	if !success(rsp) {
+		return nil, responseError(rsp)
+	}
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Page{Number: n, Request: req, Response: rsp, Body: b}, nil
+}
+
+//pageURL replace the request url, the queries of the options are dropped since the url carries them
+func pageURL(u *url.URL) ReqOpt {
+	return func(cf *requestConfig) {
+		v := *u
+		cf.URL = &v
+		cf.Queries = make(map[string]string)
+	}
+}
+
+//LinkPagination follow the RFC 8288 Link header with rel="next"
+func LinkPagination() Pagination {
+	return PaginationFunc(func(page *Page) ([]ReqOpt, bool, error) {
+		if page == nil {
+			return nil, true, nil
+		}
+		for _, link := range parseLinks(page.Response.Header["Link"]) {
+			if link.rel["next"] {
+				u, err := page.Request.URL.Parse(link.target)
+				if err != nil {
+					return nil, false, errors.Annotate(err, "link next url parse failed")
+				}
+				return []ReqOpt{pageURL(u)}, true, nil
+			}
+		}
+		return nil, false, nil
+	})
+}
+
+//CursorPagination read the cursor of the next page from the json body at the path (dot separated,
+//eg. "meta.next_cursor"), & send it by the query param. An empty or missing cursor ends the pagination.
+func CursorPagination(path string, param string) Pagination {
+	return PaginationFunc(func(page *Page) ([]ReqOpt, bool, error) {
+		if page == nil {
+			return nil, true, nil
+		}
+		v := json.Get(page.Body, jsonPath(path)...)
+		if v.LastError() != nil {
+			return nil, false, nil
+		}
+		cursor := v.ToString()
+		if v.ValueType() == json.NilValue || len(cursor) == 0 {
+			return nil, false, nil
+		}
+		return []ReqOpt{Query(param, cursor)}, true, nil
+	})
+}
+
+//PagePagination send the page number by the query param starting from first, until the json array
+//at the items path (dot separated, empty for the body itself) is empty
+func PagePagination(param string, first int, itemsPath string) Pagination {
+	return PaginationFunc(func(page *Page) ([]ReqOpt, bool, error) {
+		if page == nil {
+			return []ReqOpt{Query(param, strconv.Itoa(first))}, true, nil
+		}
+		count, err := countItems(page.Body, itemsPath)
+		if err != nil || count == 0 {
+			return nil, false, err
+		}
+		return []ReqOpt{Query(param, strconv.Itoa(first+page.Number))}, true, nil
+	})
+}
+
+//OffsetPagination send the offset & limit by the query params, until the json array at the items path
+//(dot separated, empty for the body itself) holds less than limit items
+func OffsetPagination(offsetParam string, limitParam string, limit int, itemsPath string) Pagination {
+	opts := func(offset int) []ReqOpt {
+		return []ReqOpt{Query(offsetParam, strconv.Itoa(offset)), Query(limitParam, strconv.Itoa(limit))}
+	}
+	return PaginationFunc(func(page *Page) ([]ReqOpt, bool, error) {
+		if page == nil {
+			return opts(0), true, nil
+		}
+		count, err := countItems(page.Body, itemsPath)
+		if err != nil || count < limit {
+			return nil, false, err
+		}
+		return opts(page.Number * limit), true, nil
+	})
+}
+
+func countItems(body []byte, path string) (int, error) {
+	v := json.Get(body, jsonPath(path)...)
+	if v.LastError() != nil || v.ValueType() != json.ArrayValue {
+		return 0, errors.Errorf("json array %q not found", path)
+	}
+	return v.Size(), nil
+}
+
+func jsonPath(path string) []interface{} {
+	keys := []interface{}{}
+	for _, k := range strings.Split(path, ".") {
+		if len(k) == 0 {
+			continue
+		}
+		if i, err := strconv.Atoi(k); err == nil {
+			keys = append(keys, i)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+type link struct {
+	target string
+	rel    map[string]bool
+}
+
+//parseLinks of Link header values: <target>; rel="next prev", <target>; rel=last
+func parseLinks(values []string) []link {
+	links := []link{}
+	for _, value := range values {
+		for len(value) > 0 {
+			start := strings.IndexByte(value, '<')
+			end := strings.IndexByte(value, '>')
+			if start < 0 || end < start {
+				break
+			}
+			l := link{target: value[start+1 : end], rel: map[string]bool{}}
+			value = value[end+1:]
+			//params until the next link
+			params := value
+			if i := strings.IndexByte(value, '<'); i >= 0 {
+				params, value = value[:i], value[i:]
+			} else {
+				value = ""
+			}
+			for _, param := range strings.Split(params, ";") {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+					continue
+				}
+				rel := strings.Trim(strings.TrimSpace(strings.TrimRight(strings.TrimSpace(kv[1]), ",")), `"`)
+				for _, r := range strings.Fields(rel) {
+					l.rel[strings.ToLower(r)] = true
+				}
+			}
+			links = append(links, l)
+		}
+	}
+	return links
+}
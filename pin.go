@@ -0,0 +1,177 @@
+package httpclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/x-mod/errors"
+)
+
+//ErrPinMismatch the server presented no certificate of the pinned public keys
+var ErrPinMismatch = errors.New("certificate pin mismatch")
+
+//PinError the chain presented by the host matches none of the pins
+type PinError struct {
+	Host  string
+	Pins  []string
+	Chain []*x509.Certificate
+}
+
+func (e *PinError) Error() string {
+	subjects := make([]string, len(e.Chain))
+	for i, cert := range e.Chain {
+		subjects[i] = fmt.Sprintf("%s (sha256/%s)", cert.Subject.String(), SPKIHash(cert))
+	}
+	return fmt.Sprintf("certificate pin mismatch of %s: presented [%s]", e.Host, strings.Join(subjects, ", "))
+}
+
+//Is ErrPinMismatch
+func (e *PinError) Is(target error) bool {
+	return target == ErrPinMismatch
+}
+
+//SPKIHash the pin of the certificate, base64 of the sha256 of its SubjectPublicKeyInfo
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+type pinConfig struct {
+	pins       map[string][]string
+	reportOnly func(err *PinError)
+	//roots verifying the chains when the handshake didn't, the RootCAs of the config by default
+	roots func() (*x509.CertPool, error)
+}
+
+//PinOpt of PublicKeyPins
+type PinOpt func(*pinConfig)
+
+//Pin opt, the pins of the host, the primary & the backup pins of the next keys, any match is accepted.
+//A pin is the SPKIHash, "sha256/" prefixed or not. The host "*.example.com" pins all the subdomains,
+//the exact host is preferred.
+func Pin(host string, pins ...string) PinOpt {
+	return func(pc *pinConfig) {
+		host = strings.ToLower(host)
+		for _, pin := range pins {
+			pc.pins[host] = append(pc.pins[host], strings.TrimPrefix(pin, "sha256/"))
+		}
+	}
+}
+
+//PinReportOnly opt, the mismatches are reported to the function instead of failing the connection
+func PinReportOnly(fn func(err *PinError)) PinOpt {
+	return func(pc *pinConfig) {
+		pc.reportOnly = fn
+	}
+}
+
+//PublicKeyPins opt, verify the servers by the pins of their public keys after the certificate verification,
+//a mismatch fails the connection with a *PinError. The pins are matched against the verified chains only.
+//The host is the server name (SNI), the servers dialed by ip address are never pinned unless the ServerName
+//is set in TLSConfig. The hosts without pins are not pinned.
+func PublicKeyPins(opts ...PinOpt) Opt {
+	return func(cf *config) {
+		if cf.pins == nil {
+			cf.pins = &pinConfig{pins: make(map[string][]string)}
+		}
+		for _, opt := range opts {
+			opt(cf.pins)
+		}
+	}
+}
+
+//config of the base verifying the pins by VerifyConnection
+func (pc *pinConfig) config(base *tls.Config) *tls.Config {
+	cfg := &tls.Config{}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	roots := pc.roots
+	if roots == nil {
+		pool := cfg.RootCAs
+		roots = func() (*x509.CertPool, error) {
+			return pool, nil
+		}
+	}
+	verify := cfg.VerifyConnection
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(cs); err != nil {
+				return err
+			}
+		}
+		return pc.verify(cs, roots)
+	}
+	return cfg
+}
+
+//pinsOf the host, exact or by the closest wildcard
+func (pc *pinConfig) pinsOf(host string) []string {
+	host = strings.ToLower(host)
+	if pins, ok := pc.pins[host]; ok {
+		return pins
+	}
+	for i := strings.Index(host, "."); i >= 0; {
+		if pins, ok := pc.pins["*"+host[i:]]; ok {
+			return pins
+		}
+		next := strings.Index(host[i+1:], ".")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil
+}
+
+//verifiedChains of the connection, verified by the roots when the handshake skipped the verification
+func verifiedChains(cs tls.ConnectionState, roots func() (*x509.CertPool, error)) [][]*x509.Certificate {
+	if len(cs.VerifiedChains) > 0 {
+		return cs.VerifiedChains
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+	pool, err := roots()
+	if err != nil {
+		return nil
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         pool,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	chains, _ := cs.PeerCertificates[0].Verify(opts)
+	return chains
+}
+
+func (pc *pinConfig) verify(cs tls.ConnectionState, roots func() (*x509.CertPool, error)) error {
+	pins := pc.pinsOf(cs.ServerName)
+	if len(pins) == 0 {
+		return nil
+	}
+	chains := verifiedChains(cs, roots)
+	for _, chain := range chains {
+		for _, cert := range chain {
+			hash := SPKIHash(cert)
+			for _, pin := range pins {
+				if pin == hash {
+					return nil
+				}
+			}
+		}
+	}
+	err := &PinError{Host: cs.ServerName, Pins: pins, Chain: cs.PeerCertificates}
+	if pc.reportOnly != nil {
+		pc.reportOnly(err)
+		return nil
+	}
+	return err
+}
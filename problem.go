@@ -0,0 +1,129 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	json "github.com/json-iterator/go"
+)
+
+//max bytes of a problem+json body to decode
+const maxProblemBody = 1 << 20
+
+//ProblemError RFC 9457 problem details of a non-2xx application/problem+json response
+type ProblemError struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	//Extensions members other than the standard ones
+	Extensions map[string]interface{}
+	//StatusCode of the response
+	StatusCode int
+	//Header of the response
+	Header http.Header
+}
+
+//Error implemention
+func (e *ProblemError) Error() string {
+	msg := fmt.Sprintf("problem %d", e.Value())
+	if len(e.Title) > 0 {
+		msg += ": " + e.Title
+	}
+	if len(e.Detail) > 0 {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+//Value implemention of errors.Code, the problem status or the response status code
+func (e *ProblemError) Value() int32 {
+	if e.Status > 0 {
+		return int32(e.Status)
+	}
+	return int32(e.StatusCode)
+}
+
+//String implemention of errors.Code
+func (e *ProblemError) String() string {
+	if len(e.Title) > 0 {
+		return e.Title
+	}
+	return http.StatusText(int(e.Value()))
+}
+
+//UnmarshalJSON standard members with an unexpected type are ignored (RFC 9457 3.1)
+func (e *ProblemError) UnmarshalJSON(b []byte) error {
+	members := map[string]interface{}{}
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+	e.Type = "about:blank"
+	if v, ok := members["type"].(string); ok {
+		e.Type = v
+	}
+	if v, ok := members["title"].(string); ok {
+		e.Title = v
+	}
+	if v, ok := members["status"].(float64); ok {
+		e.Status = int(v)
+	}
+	if v, ok := members["detail"].(string); ok {
+		e.Detail = v
+	}
+	if v, ok := members["instance"].(string); ok {
+		e.Instance = v
+	}
+	for _, k := range []string{"type", "title", "status", "detail", "instance"} {
+		delete(members, k)
+	}
+	if len(members) > 0 {
+		e.Extensions = members
+	}
+	return nil
+}
+
+//isProblem non-2xx application/problem+json response
+func isProblem(rsp *http.Response) bool {
+	if success(rsp) {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(rsp.Header.Get("Content-Type"))
+	return err == nil && mt == "application/problem+json"
+}
+
+//decodeProblem the body is consumed, a *StatusError of the read bytes returns when it isn't a valid problem
+func decodeProblem(rsp *http.Response) error {
+	b, err := ioutil.ReadAll(io.LimitReader(rsp.Body, maxProblemBody))
+	if err != nil {
+		return err
+	}
+	problem := &ProblemError{StatusCode: rsp.StatusCode, Header: rsp.Header}
+	if err := json.Unmarshal(b, problem); err != nil {
+		serr := &StatusError{StatusCode: rsp.StatusCode, Status: rsp.Status, Header: rsp.Header, Body: b}
+		if int64(len(b)) > DefaultErrorBodyLimit {
+			serr.Body = b[:DefaultErrorBodyLimit]
+		}
+		return serr
+	}
+	return problem
+}
+
+//Problems processor, a non-2xx application/problem+json response returns a *ProblemError, the others go to the processor
+func Problems(processor ResponseProcessor) ResponseProcessor {
+	return ResponseProcessorFunc(func(ctx context.Context, rsp *http.Response) error {
+		if isProblem(rsp) {
+			defer drainBody(rsp.Body)
+			return decodeProblem(rsp)
+		}
+		if processor == nil {
+			return nil
+		}
+		return processor.Process(ctx, rsp)
+	})
+}
@@ -0,0 +1,200 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+//DefaultChainBodyLimit max bytes of the response body buffered by Chain
+var DefaultChainBodyLimit int64 = 32 << 20
+
+//Chain processors, the body is buffered so every processor reads it from the start, stop at the first error.
+//A body larger than DefaultChainBodyLimit fails with a *BodyTooLargeError.
+func Chain(processors ...ResponseProcessor) ResponseProcessor {
+	return ResponseProcessorFunc(func(ctx context.Context, rsp *http.Response) error {
+		defer drainBody(rsp.Body)
+		b, err := ioutil.ReadAll(&limitedBody{ReadCloser: rsp.Body, limit: DefaultChainBodyLimit, remain: DefaultChainBodyLimit})
+		if err != nil {
+			return err
+		}
+		for _, p := range processors {
+			if p == nil {
+				continue
+			}
+			r := *rsp
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+			if err := p.Process(ctx, &r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//StatusMatcher match a response status code
+type StatusMatcher func(code int) bool
+
+//Status match any of the codes
+func Status(codes ...int) StatusMatcher {
+	return func(code int) bool {
+		for _, c := range codes {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//StatusRange match the codes in [min, max]
+func StatusRange(min int, max int) StatusMatcher {
+	return func(code int) bool {
+		return code >= min && code <= max
+	}
+}
+
+var (
+	//Status2xx success codes
+	Status2xx = StatusRange(200, 299)
+	//Status4xx client error codes
+	Status4xx = StatusRange(400, 499)
+	//Status5xx server error codes
+	Status5xx = StatusRange(500, 599)
+)
+
+type statusRoute struct {
+	match     StatusMatcher
+	processor ResponseProcessor
+}
+
+//StatusRouter processor, route the response to the first processor matching its status code
+type StatusRouter struct {
+	routes   []statusRoute
+	fallback ResponseProcessor
+}
+
+//OnStatus new StatusRouter, route the responses matching the status to processor
+func OnStatus(match StatusMatcher, processor ResponseProcessor) *StatusRouter {
+	return (&StatusRouter{}).OnStatus(match, processor)
+}
+
+//OnStatus add a route
+func (r *StatusRouter) OnStatus(match StatusMatcher, processor ResponseProcessor) *StatusRouter {
+	r.routes = append(r.routes, statusRoute{match: match, processor: processor})
+	return r
+}
+
+//Otherwise fallback processor for the unmatched responses, which return a *StatusError (or *ProblemError) by default
+func (r *StatusRouter) Otherwise(processor ResponseProcessor) *StatusRouter {
+	r.fallback = processor
+	return r
+}
+
+//Process implemention of ResponseProcessor
+func (r *StatusRouter) Process(ctx context.Context, rsp *http.Response) error {
+	defer drainBody(rsp.Body)
+	for _, route := range r.routes {
+		if route.match(rsp.StatusCode) {
+			if route.processor == nil {
+				return nil
+			}
+			return route.processor.Process(ctx, rsp)
+		}
+	}
+	if r.fallback != nil {
+		return r.fallback.Process(ctx, rsp)
+	}
+	return responseError(rsp)
+}
+
+//ExpectStatus processor, return a *StatusError (or *ProblemError) unless the status is one of the codes (2xx by default).
+//It leaves the body unread on success, so it's meant to lead a Chain.
+func ExpectStatus(codes ...int) ResponseProcessor {
+	match := Status2xx
+	if len(codes) > 0 {
+		match = Status(codes...)
+	}
+	return ResponseProcessorFunc(func(ctx context.Context, rsp *http.Response) error {
+		if match(rsp.StatusCode) {
+			return nil
+		}
+		return responseError(rsp)
+	})
+}
+
+//Tee processor, copy the body to wr while the processor reads it, the unread rest is copied too
+func Tee(wr io.Writer, processor ResponseProcessor) ResponseProcessor {
+	return ResponseProcessorFunc(func(ctx context.Context, rsp *http.Response) error {
+		defer drainBody(rsp.Body)
+		body := rsp.Body
+		r := *rsp
+		r.Body = ioutil.NopCloser(io.TeeReader(body, wr))
+		if processor != nil {
+			if err := processor.Process(ctx, &r); err != nil {
+				return err
+			}
+		}
+		_, err := io.Copy(ioutil.Discard, r.Body)
+		return err
+	})
+}
+
+//LimitBody processor, the processor reads at most limit bytes of the body, reading more fails with a *BodyTooLargeError
+func LimitBody(limit int64, processor ResponseProcessor) ResponseProcessor {
+	return ResponseProcessorFunc(func(ctx context.Context, rsp *http.Response) error {
+		defer drainBody(rsp.Body)
+		r := *rsp
+		r.Body = &limitedBody{ReadCloser: rsp.Body, limit: limit, remain: limit}
+		return processor.Process(ctx, &r)
+	})
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	limit  int64
+	remain int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remain < 0 {
+		return 0, &BodyTooLargeError{Limit: l.limit}
+	}
+	if int64(len(p)) > l.remain+1 {
+		p = p[:l.remain+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remain -= int64(n)
+	if l.remain < 0 {
+		return n + int(l.remain), &BodyTooLargeError{Limit: l.limit}
+	}
+	return n, err
+}
+
+//Captured response
+type Captured struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Trailer    http.Header
+	Body       []byte
+}
+
+//Capture processor, read the whole body & keep the response status, headers & trailers
+func Capture(captured *Captured) ResponseProcessor {
+	return ResponseProcessorFunc(func(ctx context.Context, rsp *http.Response) error {
+		defer drainBody(rsp.Body)
+		b, err := ioutil.ReadAll(rsp.Body)
+		if err != nil {
+			return err
+		}
+		captured.StatusCode = rsp.StatusCode
+		captured.Status = rsp.Status
+		captured.Header = rsp.Header
+		captured.Trailer = rsp.Trailer
+		captured.Body = b
+		return nil
+	})
+}
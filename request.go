@@ -1,6 +1,7 @@
 package httpclient
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/url"
@@ -9,9 +10,58 @@ import (
 	"github.com/x-mod/errors"
 )
 
-//RequestBuilder struct
+var (
+	//ErrInvalidURL the request url can't be parsed or is incomplete
+	ErrInvalidURL = errors.New("invalid url")
+	//ErrMissingHost the request url has no host
+	ErrMissingHost = errors.New("missing host")
+	//ErrUnsupportedMethod the request method isn't in SupportedMethods
+	ErrUnsupportedMethod = errors.New("unsupported method")
+	//ErrBodyNotAllowed a body is set on a GET or HEAD request
+	ErrBodyNotAllowed = errors.New("body not allowed")
+	//ErrAuthConflict more than one authorization is set on the request
+	ErrAuthConflict = errors.New("conflicting auth options")
+	//ErrInvalidHeader the header name or value is malformed
+	ErrInvalidHeader = errors.New("invalid header")
+	//ErrInvalidBody the body content can't be encoded
+	ErrInvalidBody = errors.New("invalid body")
+)
+
+//SupportedMethods accepted by the request builder, add custom methods (eg. WebDAV) before making requests
+var SupportedMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+//ValidationError lists each problem found when making a request
+type ValidationError struct {
+	Errors []error
+}
+
+//Error implemention
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return "request validation failed: " + strings.Join(msgs, "; ")
+}
+
+//Unwrap the problems, so errors.Is & errors.As match any of them
+func (e *ValidationError) Unwrap() []error {
+	return e.Errors
+}
+
+//RequestBuilder struct, keeps the options & builds a new request each time
 type RequestBuilder struct {
-	config *requestConfig
+	opts []ReqOpt
 }
 
 //ReqOpt opt
@@ -24,14 +74,15 @@ func Method(method string) ReqOpt {
 	}
 }
 
-//URL opt
+//URL opt, the unix socket urls "unix:///path/to.sock:/request/path" & "http+unix://%2Fpath%2Fto.sock/request/path" supported
 func SetURL(Url string) ReqOpt {
 	return func(cf *requestConfig) {
-		u, err := url.Parse(Url)
+		u, socket, err := parseURL(Url)
 		if err != nil {
-			panic(err)
+			cf.errs = append(cf.errs, errors.Errorf("%w: %v", ErrInvalidURL, err))
+			return
 		}
-		cf.URL = u
+		cf.URL, cf.options.socket = u, socket
 	}
 }
 
@@ -41,52 +92,63 @@ func URL(opts ...URLOpt) ReqOpt {
 		if cf.URL == nil {
 			cf.URL = &url.URL{}
 		}
+		uc := &urlConfig{URL: cf.URL}
 		for _, opt := range opts {
-			opt(cf.URL)
+			opt(uc)
 		}
+		cf.errs = append(cf.errs, uc.errs...)
 	}
 }
 
-type URLOpt func(*url.URL)
+//URLOpt opt
+type URLOpt func(*urlConfig)
 
 //URI opt
 func URI(uri string) URLOpt {
-	return func(u *url.URL) {
+	return func(u *urlConfig) {
 		u.Path = uri
 	}
 }
 
 //Scheme opt
 func Scheme(scheme string) URLOpt {
-	return func(u *url.URL) {
+	return func(u *urlConfig) {
+		if !validScheme(scheme) {
+			u.errs = append(u.errs, errors.Errorf("%w: scheme %q malformed", ErrInvalidURL, scheme))
+			return
+		}
 		u.Scheme = scheme
 	}
 }
 
 //User opt
 func User(user string) URLOpt {
-	return func(u *url.URL) {
+	return func(u *urlConfig) {
 		u.User = url.User(user)
 	}
 }
 
 //UserPassword opt
 func UserPassword(username string, password string) URLOpt {
-	return func(u *url.URL) {
+	return func(u *urlConfig) {
 		u.User = url.UserPassword(username, password)
 	}
 }
 
 //Host opt [ip:port]
 func Host(host string) URLOpt {
-	return func(u *url.URL) {
+	return func(u *urlConfig) {
+		if h, err := url.Parse("//" + host); err != nil || h.Host != host {
+			u.errs = append(u.errs, errors.Errorf("%w: host %q malformed", ErrInvalidURL, host))
+			return
+		}
 		u.Host = host
 	}
 }
 
 //Fragment opt
 func Fragment(name string) URLOpt {
-	return func(u *url.URL) {
+	return func(u *urlConfig) {
 		u.Fragment = name
 	}
 }
@@ -101,6 +163,10 @@ func Query(name string, value string) ReqOpt {
 //Header opt
 func Header(name string, value string) ReqOpt {
 	return func(cf *requestConfig) {
+		if !validHeaderName(name) || strings.ContainsAny(value, "\r\n\x00") {
+			cf.errs = append(cf.errs, errors.Errorf("%w: %q", ErrInvalidHeader, name))
+			return
+		}
 		cf.Header.Add(name, value)
 	}
 }
@@ -117,28 +183,23 @@ func Cookie(cookie *http.Cookie) ReqOpt {
 //BasicAuth opt
 func BasicAuth(username string, password string) ReqOpt {
 	return func(cf *requestConfig) {
-		cf.Auth = &authConfig{
-			username: username,
-			password: password,
-		}
+		cf.setAuth("BasicAuth", Basic(username, password))
 	}
 }
 
 //BearerAuth opt
 func BearerAuth(token string) ReqOpt {
 	return func(cf *requestConfig) {
-		cf.Token = &tokenConfig{
-			token: token,
-		}
+		cf.setAuth("BearerAuth", Bearer(token))
 	}
 }
 
-//BearerAuthFunc opt
+//BearerAuthFunc opt, the token is got per attempt, an empty token fails the request
 func BearerAuthFunc(token TokenFunc) ReqOpt {
 	return func(cf *requestConfig) {
-		cf.Token = &tokenConfig{
-			tokenGet: token,
-		}
+		cf.setAuth("BearerAuth", BearerFunc(func(context.Context) (string, error) {
+			return token(), nil
+		}))
 	}
 }
 
@@ -150,84 +211,220 @@ func Content(opts ...BodyOpt) ReqOpt {
 			opt(body)
 		}
 		cf.Content = &Body{config: body}
+		cf.errs = append(cf.errs, body.errs...)
 	}
 }
 
 //NewRequestBuilder new
 func NewRequestBuilder(opts ...ReqOpt) *RequestBuilder {
+	return &RequestBuilder{opts: opts}
+}
+
+//With a new builder with the options appended, the builder itself is unchanged
+func (b *RequestBuilder) With(opts ...ReqOpt) *RequestBuilder {
+	all := make([]ReqOpt, 0, len(b.opts)+len(opts))
+	return &RequestBuilder{opts: append(append(all, b.opts...), opts...)}
+}
+
+//Options of the builder
+func (b *RequestBuilder) Options() []ReqOpt {
+	return append([]ReqOpt{}, b.opts...)
+}
+
+//MakeRequest make a new http.Request
+func (b *RequestBuilder) MakeRequest() (*http.Request, error) {
+	return newRequestConfig(nil, b.opts).makeRequest()
+}
+
+//newRequestConfig apply the default options first, then the request's own options.
+//Headers, cookies & auth set by the request's options replace the defaults of the same kind,
+//the other fields are overridden by whichever option comes last.
+func newRequestConfig(defaults []ReqOpt, opts []ReqOpt) *requestConfig {
 	config := &requestConfig{
 		Header:  make(http.Header),
 		Queries: make(map[string]string),
 		Cookies: []*http.Cookie{},
 	}
+	for _, opt := range defaults {
+		opt(config)
+	}
+	header, cookies, auths := config.Header, config.Cookies, config.auths
+	config.Header, config.Cookies, config.auths = make(http.Header), []*http.Cookie{}, nil
 	for _, opt := range opts {
 		opt(config)
 	}
-	return &RequestBuilder{config: config}
+	//auth, an explicit Authorization header overrides the default auth too
+	if _, ok := config.Header["Authorization"]; !ok && len(config.auths) == 0 {
+		config.auths = auths
+	}
+	//headers
+	for k, v := range header {
+		if _, ok := config.Header[k]; !ok {
+			config.Header[k] = v
+		}
+	}
+	//cookies
+	merged := []*http.Cookie{}
+	for _, c := range cookies {
+		overridden := false
+		for _, v := range config.Cookies {
+			if v.Name == c.Name {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, c)
+		}
+	}
+	config.Cookies = append(merged, config.Cookies...)
+	return config
 }
 
 //MakeRequest make a http.Request
 func MakeRequest(opts ...ReqOpt) (*http.Request, error) {
-	builder := NewRequestBuilder(opts...)
-	return builder.makeRequest()
+	return NewRequestBuilder(opts...).MakeRequest()
 }
 
-func (req *RequestBuilder) makeRequest() (*http.Request, error) {
-	if req.config.URL == nil {
-		return nil, errors.New("url required")
+//validate the request config, returns all the problems found
+func (cf *requestConfig) validate() []error {
+	errs := append([]error{}, cf.errs...)
+	if cf.URL == nil {
+		if len(cf.errs) == 0 {
+			errs = append(errs, errors.Errorf("%w: url required", ErrInvalidURL))
+		}
+	} else {
+		if len(cf.URL.Scheme) == 0 {
+			errs = append(errs, errors.Errorf("%w: %q scheme required", ErrInvalidURL, cf.URL.String()))
+		}
+		if len(cf.URL.Host) == 0 {
+			errs = append(errs, errors.Errorf("%w: %q", ErrMissingHost, cf.URL.String()))
+		}
 	}
-	//url
-	if len(req.config.Queries) > 0 {
-		q := req.config.URL.Query()
-		for k, v := range req.config.Queries {
-			q.Add(k, v)
+	method := cf.Method
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+	if !SupportedMethods[method] {
+		errs = append(errs, errors.Errorf("%w: %q", ErrUnsupportedMethod, method))
+	}
+	if cf.Content != nil && (method == http.MethodGet || method == http.MethodHead) {
+		errs = append(errs, errors.Errorf("%w: on %s request", ErrBodyNotAllowed, method))
+	}
+	auths := []string{}
+	if cf.URL != nil && cf.URL.User != nil {
+		if _, ok := cf.URL.User.Password(); ok {
+			auths = append(auths, "url userinfo")
 		}
-		req.config.URL.RawQuery = q.Encode()
 	}
+	if _, ok := cf.Header["Authorization"]; ok {
+		auths = append(auths, "Authorization header")
+	}
+	for _, a := range cf.auths {
+		auths = append(auths, a.name)
+	}
+	if len(auths) > 1 {
+		errs = append(errs, errors.Errorf("%w: %s", ErrAuthConflict, strings.Join(auths, ", ")))
+	}
+	return errs
+}
 
+func (cf *requestConfig) makeRequest() (*http.Request, error) {
+	errs := cf.validate()
 	//body
 	var body io.Reader
-	if req.config.Content != nil {
-		rd, err := req.config.Content.Get()
+	if cf.Content != nil {
+		cf.Content.codecs = cf.codecs
+		rd, err := cf.Content.Get()
 		if err != nil {
-			return nil, err
+			errs = append(errs, err)
 		}
 		body = rd
 	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	//url
+	if len(cf.Queries) > 0 {
+		q := cf.URL.Query()
+		for k, v := range cf.Queries {
+			q.Add(k, v)
+		}
+		cf.URL.RawQuery = q.Encode()
+	}
 
 	//new request
-	rr, err := http.NewRequest(req.config.Method, req.config.URL.String(), body)
+	rr, err := http.NewRequest(cf.Method, cf.URL.String(), body)
 	if err != nil {
 		return nil, err
 	}
-	rr.Header = req.config.Header.Clone()
+	rr.Header = cf.Header.Clone()
+	options := cf.options
+	rr = rr.WithContext(withRequestOptions(rr.Context(), &options))
 
 	// content-type
-	if req.config.Content != nil {
-		rr.Header.Set("Content-Type", req.config.Content.ContentType())
+	if cf.Content != nil {
+		rr.Header.Set("Content-Type", cf.Content.ContentType())
 	}
 	// cookies
-	for _, v := range req.config.Cookies {
+	for _, v := range cf.Cookies {
 		rr.AddCookie(v)
 	}
 	// url userinfo
-	if req.config.URL.User != nil {
-		usr := req.config.URL.User
+	if cf.URL.User != nil {
+		usr := cf.URL.User
 		if password, ok := usr.Password(); ok {
-			rr.SetBasicAuth(usr.Username(), password)
+			options.auth = Basic(usr.Username(), password)
 		}
 	}
-	// basic auth
-	if req.config.Auth != nil {
-		rr.SetBasicAuth(req.config.Auth.username, req.config.Auth.password)
+	// auth, applied per attempt by Client.Do with the request's context
+	if len(cf.auths) > 0 {
+		options.auth = cf.auths[0].auth
 	}
-	// bearer auth
-	if req.config.Token != nil {
-		t := req.config.Token.token
-		if req.config.Token.tokenGet != nil {
-			t = req.config.Token.tokenGet()
+	return rr, nil
+}
+
+type requestOptionsKey struct{}
+
+func withRequestOptions(ctx context.Context, options *requestOptions) context.Context {
+	return context.WithValue(ctx, requestOptionsKey{}, options)
+}
+
+func requestOptionsFrom(ctx context.Context) *requestOptions {
+	if options, ok := ctx.Value(requestOptionsKey{}).(*requestOptions); ok {
+		return options
+	}
+	return nil
+}
+
+//validScheme RFC 3986: ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+func validScheme(scheme string) bool {
+	if len(scheme) == 0 {
+		return false
+	}
+	for i, c := range scheme {
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
 		}
-		rr.Header.Set("Authorization", strings.Join([]string{"Bearer", t}, " "))
 	}
-	return rr, nil
+	return true
+}
+
+//validHeaderName RFC 7230 token
+func validHeaderName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,47 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeRequest_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ReqOpt
+		errs []error
+	}{
+		{"bad url", []ReqOpt{SetURL("http://host/100%")}, []error{ErrInvalidURL}},
+		{"missing host", []ReqOpt{SetURL("/path")}, []error{ErrInvalidURL, ErrMissingHost}},
+		{"bad host", []ReqOpt{URL(Scheme("http"), Host("a b"))}, []error{ErrInvalidURL, ErrMissingHost}},
+		{"unsupported method", []ReqOpt{SetURL("http://host"), Method("fetch")}, []error{ErrUnsupportedMethod}},
+		{"body on get", []ReqOpt{SetURL("http://host"), Content(Text("x"))}, []error{ErrBodyNotAllowed}},
+		{"auth conflict", []ReqOpt{SetURL("http://host"), BasicAuth("u", "p"), BearerAuth("t")}, []error{ErrAuthConflict}},
+		{"bad header", []ReqOpt{SetURL("http://host"), Header("X-A", "a\r\nb")}, []error{ErrInvalidHeader}},
+		{"bad body", []ReqOpt{SetURL("http://host"), Method("POST"), Content(Reader(nil))}, []error{ErrInvalidBody}},
+		{"nil pb", []ReqOpt{SetURL("http://host"), Method("POST"), Content(PB((*empty.Empty)(nil)))}, []error{ErrInvalidBody}},
+		{"nil pbjson", []ReqOpt{SetURL("http://host"), Method("POST"), Content(PBJSON((*empty.Empty)(nil)))}, []error{ErrInvalidBody}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := MakeRequest(tt.opts...)
+			assert.Nil(t, req)
+			var verr *ValidationError
+			if assert.True(t, errors.As(err, &verr)) {
+				assert.Len(t, verr.Errors, len(tt.errs))
+			}
+			for _, e := range tt.errs {
+				assert.True(t, errors.Is(err, e), "%v is not %v", err, e)
+			}
+		})
+	}
+
+	req, err := MakeRequest(SetURL("http://host/path"), Method("post"), Content(JSON(map[string]int{"a": 1})))
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+}
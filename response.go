@@ -61,7 +61,7 @@ func NewDumpResponse(opts ...DumpResponseOpt) *DumpResponse {
 //Process of DumpResponse
 func (d *DumpResponse) Process(ctx context.Context, rsp *http.Response) error {
 	defer rsp.Body.Close()
-	if _, err := io.Copy(os.Stdout, rsp.Body); err != nil {
+	if _, err := io.Copy(d.wr, rsp.Body); err != nil {
 		return err
 	}
 	log.Println("DumpResponse StatusCode:", rsp.StatusCode)
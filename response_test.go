@@ -0,0 +1,266 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type apiError struct {
+	Code    int    `json:"code" xml:"code"`
+	Message string `json:"message" xml:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func TestDecode(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/json":
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.Write([]byte(`{"code":0,"message":"ok"}`))
+			case "/xml":
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(`<apiError><code>0</code><message>ok</message></apiError>`))
+			case "/fail":
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"code":409,"message":"conflict"}`))
+			case "/empty":
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				http.NotFound(w, r)
+			}
+		}),
+	)
+	defer ts.Close()
+
+	client := New(BaseURL(ts.URL))
+	execute := func(path string, processor ResponseProcessor) error {
+		req, err := client.MakeRequest(SetURL(path))
+		assert.Nil(t, err)
+		return client.Execute(context.TODO(), req, processor)
+	}
+
+	out := apiError{}
+	assert.Nil(t, execute("/json", DecodeJSON(&out)))
+	assert.Equal(t, "ok", out.Message)
+
+	out = apiError{}
+	assert.Nil(t, execute("/xml", Decode(&out)))
+	assert.Equal(t, "ok", out.Message)
+
+	assert.Nil(t, execute("/empty", Decode(&out)))
+
+	err := execute("/fail", DecodeJSON(&out))
+	var serr *StatusError
+	if assert.True(t, errors.As(err, &serr)) {
+		assert.Equal(t, http.StatusConflict, serr.StatusCode)
+		assert.Equal(t, int32(http.StatusConflict), serr.Value())
+		assert.Equal(t, "application/json", serr.Header.Get("Content-Type"))
+		assert.Contains(t, string(serr.Body), "conflict")
+	}
+
+	err = execute("/missing", DecodeJSON(&out, ErrorBodyLimit(4)))
+	if assert.True(t, errors.As(err, &serr)) {
+		assert.Equal(t, http.StatusNotFound, serr.StatusCode)
+		assert.Len(t, serr.Body, 4)
+	}
+
+	aerr := &apiError{}
+	err = execute("/fail", DecodeJSON(&out, ErrorInto(aerr)))
+	assert.Equal(t, aerr, err)
+	assert.Equal(t, 409, aerr.Code)
+
+	//the body larger than the limit
+	err = execute("/fail", DecodeJSON(&out, ErrorInto(&apiError{}), ErrorBodyLimit(8)))
+	if assert.True(t, errors.As(err, &serr)) {
+		assert.Equal(t, http.StatusConflict, serr.StatusCode)
+		assert.Contains(t, err.Error(), "unmarshal failed")
+	}
+}
+
+func TestDumpResponse(t *testing.T) {
+	wr := &bytes.Buffer{}
+	rsp := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString("hello"))}
+	assert.Nil(t, NewDumpResponse(Output(wr)).Process(context.TODO(), rsp))
+	assert.Equal(t, "hello", wr.String())
+}
+
+func TestProcessorCombinators(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Trailer", "X-Checksum")
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/created":
+				w.WriteHeader(http.StatusCreated)
+			case "/busy":
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			w.Write([]byte(`{"code":1,"message":"hello"}`))
+			w.Header().Set("X-Checksum", "abc")
+		}),
+	)
+	defer ts.Close()
+
+	client := New(BaseURL(ts.URL))
+	execute := func(path string, processor ResponseProcessor) error {
+		req, err := client.MakeRequest(SetURL(path))
+		assert.Nil(t, err)
+		return client.Execute(context.TODO(), req, processor)
+	}
+
+	out := apiError{}
+	captured := Captured{}
+	wr := &bytes.Buffer{}
+	assert.Nil(t, execute("/", Chain(ExpectStatus(), DecodeJSON(&out), Capture(&captured), Tee(wr, nil))))
+	assert.Equal(t, "hello", out.Message)
+	assert.Equal(t, "abc", captured.Trailer.Get("X-Checksum"))
+	assert.Equal(t, string(captured.Body), wr.String())
+
+	var serr *StatusError
+	assert.True(t, errors.As(execute("/created", ExpectStatus(http.StatusOK)), &serr))
+	assert.Equal(t, http.StatusCreated, serr.StatusCode)
+
+	assert.True(t, errors.Is(execute("/", LimitBody(8, DecodeJSON(&out))), ErrBodyTooLarge))
+	assert.Nil(t, execute("/", LimitBody(64, DecodeJSON(&out))))
+
+	limit := DefaultChainBodyLimit
+	DefaultChainBodyLimit = 8
+	assert.True(t, errors.Is(execute("/", Chain(DecodeJSON(&out))), ErrBodyTooLarge))
+	DefaultChainBodyLimit = limit
+
+	routed := ""
+	mark := func(name string) ResponseProcessor {
+		return ResponseProcessorFunc(func(ctx context.Context, rsp *http.Response) error {
+			routed = name
+			return nil
+		})
+	}
+	router := OnStatus(Status(http.StatusCreated), mark("created")).OnStatus(Status5xx, mark("retry"))
+	assert.Nil(t, execute("/created", router))
+	assert.Equal(t, "created", routed)
+	assert.Nil(t, execute("/busy", router))
+	assert.Equal(t, "retry", routed)
+	assert.True(t, errors.As(execute("/", router), &serr))
+	assert.Nil(t, execute("/", router.Otherwise(mark("fallback"))))
+	assert.Equal(t, "fallback", routed)
+}
+
+func TestProblemError(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{
+				"type": "https://example.com/probs/out-of-credit",
+				"title": "You do not have enough credit.",
+				"status": 403,
+				"detail": "Your current balance is 30, but that costs 50.",
+				"instance": "/account/12345/msgs/abc",
+				"balance": 30,
+				"accounts": ["/account/12345", "/account/67890"]
+			}`))
+		}),
+	)
+	defer ts.Close()
+
+	check := func(err error) {
+		var problem *ProblemError
+		if assert.True(t, errors.As(err, &problem)) {
+			assert.Equal(t, "https://example.com/probs/out-of-credit", problem.Type)
+			assert.Equal(t, int32(http.StatusForbidden), problem.Value())
+			assert.Equal(t, "You do not have enough credit.", problem.String())
+			assert.Equal(t, "/account/12345/msgs/abc", problem.Instance)
+			assert.Equal(t, float64(30), problem.Extensions["balance"])
+			assert.Len(t, problem.Extensions, 2)
+		}
+	}
+
+	req, err := MakeRequest(SetURL(ts.URL))
+	assert.Nil(t, err)
+	check(New().Execute(context.TODO(), req, DecodeJSON(&apiError{})))
+	check(New().Execute(context.TODO(), req, Problems(nil)))
+	check(New(ProblemDetails(true)).Execute(context.TODO(), req, nil))
+	assert.Nil(t, New().Execute(context.TODO(), req, nil))
+}
+
+func TestStreamJSON(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/ndjson":
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.Write([]byte("{\"code\":1}\n\n{\"code\":2}\r\n{\"code\":3}"))
+			case "/seq":
+				w.Header().Set("Content-Type", "application/json-seq")
+				w.Write([]byte("\x1e{\"code\":1}\n\x1e{\"code\":2}\n"))
+			case "/seq-broken":
+				w.Header().Set("Content-Type", "application/json-seq")
+				w.Write([]byte("\x1e{\n\"code\":1\n}\n\x1e{\"code\":\n"))
+			case "/broken":
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.Write([]byte("{\"code\":1}\n{\"code\":\n"))
+			case "/long":
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.Write([]byte("{\"code\":1}\n{\"message\":\"" + strings.Repeat("x", 64) + "\"}\n"))
+			}
+		}),
+	)
+	defer ts.Close()
+
+	client := New(BaseURL(ts.URL))
+	stream := func(path string, opts ...StreamOpt) ([]int, error) {
+		codes := []int{}
+		req, err := client.MakeRequest(SetURL(path))
+		assert.Nil(t, err)
+		err = client.Execute(context.TODO(), req, StreamJSON(func(ctx context.Context, item *StreamItem) error {
+			out := apiError{}
+			if err := item.Decode(&out); err != nil {
+				return err
+			}
+			codes = append(codes, out.Code)
+			return nil
+		}, opts...))
+		return codes, err
+	}
+
+	codes, err := stream("/ndjson")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2, 3}, codes)
+
+	codes, err = stream("/seq")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2}, codes)
+
+	var serr *StreamError
+	codes, err = stream("/broken")
+	if assert.True(t, errors.As(err, &serr)) {
+		assert.Equal(t, 2, serr.Record)
+		assert.True(t, errors.Is(err, ErrInvalidJSON))
+	}
+	assert.Equal(t, []int{1}, codes)
+
+	//the records of multiple lines
+	codes, err = stream("/seq-broken")
+	if assert.True(t, errors.As(err, &serr)) {
+		assert.Equal(t, 2, serr.Record)
+	}
+	assert.Equal(t, []int{1}, codes)
+
+	_, err = stream("/long", MaxLineSize(32))
+	if assert.True(t, errors.As(err, &serr)) {
+		assert.Equal(t, 2, serr.Record)
+	}
+}
@@ -0,0 +1,42 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+)
+
+//Signer sign the final request, invoked for every attempt after the authenticator,
+//so each retry is signed freshly, eg. with a new timestamp
+type Signer interface {
+	Sign(ctx context.Context, req *http.Request) error
+}
+
+//SignerFunc custom signer
+type SignerFunc func(ctx context.Context, req *http.Request) error
+
+//Sign implemention of Signer
+func (f SignerFunc) Sign(ctx context.Context, req *http.Request) error {
+	return f(ctx, req)
+}
+
+//Sign opt, sign the request by the signer, override the client's Signing
+func Sign(s Signer) ReqOpt {
+	return func(cf *requestConfig) {
+		cf.options.signer = s
+	}
+}
+
+//Signing opt, sign every request by the signer
+func Signing(s Signer) Opt {
+	return func(cf *config) {
+		cf.signer = s
+	}
+}
+
+//signer of the request, or the client's
+func (c *Client) signer(req *http.Request) Signer {
+	if options := requestOptionsFrom(req.Context()); options != nil && options.signer != nil {
+		return options.signer
+	}
+	return c.config.signer
+}
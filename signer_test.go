@@ -0,0 +1,80 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	//RFC 9421 B.2.5
+	key, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+	req, _ := http.NewRequest("POST", "https://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	signer := MessageSignature("test-shared-secret", key, SignatureLabel("sig-b25"),
+		SignatureComponents("date", "@authority", "content-type"),
+		SignatureClock(func() time.Time { return time.Unix(1618884473, 0) }))
+	assert.Nil(t, signer.Sign(context.TODO(), req))
+	assert.Equal(t, `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`, req.Header.Get("Signature-Input"))
+	assert.Equal(t, "sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:", req.Header.Get("Signature"))
+
+	hmacOpts := []HMACOpt{
+		HMACTemplate("{{.Method}}|{{.Path}}|{{.Query}}|{{.Header.Get \"X-Key\"}}|{{.Timestamp}}|{{.Nonce}}|{{.BodyHash}}"),
+		HMACTimestamp("X-Timestamp", ""),
+		HMACNonce("X-Nonce"),
+		HMACSignatureHeader("Authorization", func(sig []byte) string {
+			return "HMAC partner:" + base64.StdEncoding.EncodeToString(sig)
+		}),
+	}
+	var calls int32
+	nonces := map[string]bool{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/hmac") {
+			assert.Nil(t, VerifyHMAC(r, []byte("secret"), hmacOpts...))
+			assert.False(t, nonces[r.Header.Get("X-Nonce")])
+			nonces[r.Header.Get("X-Nonce")] = true
+		} else {
+			assert.Nil(t, VerifyMessageSignature(r, func(keyID string) ([]byte, error) {
+				assert.Equal(t, "client", keyID)
+				return []byte("shared"), nil
+			}))
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "body", string(b))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			hj, _ := w.(http.Hijacker)
+			conn, _, _ := hj.Hijack()
+			conn.Close()
+		}
+	}))
+	defer ts.Close()
+
+	//signed again for the retry
+	client := New(BaseURL(ts.URL), Retry(2), Signing(HMACSigner([]byte("secret"), hmacOpts...)))
+	req, err := client.MakeRequest(Method("POST"), SetURL("/hmac?b=2&a=1"), Header("X-Key", "k"), Content(Text("body")))
+	assert.Nil(t, err)
+	assert.Nil(t, client.Execute(context.TODO(), req, ExpectStatus()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Len(t, nonces, 2)
+
+	req, err = client.MakeRequest(Method("PUT"), SetURL("/rfc9421"), Content(Text("body")),
+		Sign(MessageSignature("client", []byte("shared"), SignatureNonce(), SignatureExpires(time.Minute))))
+	assert.Nil(t, err)
+	assert.Nil(t, client.Execute(context.TODO(), req, ExpectStatus()))
+
+	//tampered
+	req, _ = http.NewRequest("POST", "http://host/hmac", strings.NewReader("body"))
+	assert.Nil(t, HMACSigner([]byte("secret"), hmacOpts...).Sign(context.TODO(), req))
+	req.URL.RawQuery = "a=2"
+	assert.True(t, errors.Is(VerifyHMAC(req, []byte("secret"), hmacOpts...), ErrInvalidSignature))
+}
@@ -0,0 +1,135 @@
+package sigv4
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/x-mod/errors"
+)
+
+//Credentials of aws, the session token is optional
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+//CredentialsProvider get the credentials, invoked for every signing
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+//CredentialsProviderFunc custom credentials provider
+type CredentialsProviderFunc func(ctx context.Context) (Credentials, error)
+
+//Retrieve implemention of CredentialsProvider
+func (f CredentialsProviderFunc) Retrieve(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+//StaticCredentials provider
+func StaticCredentials(accessKeyID string, secretAccessKey string, sessionToken string) CredentialsProvider {
+	return CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey, SessionToken: sessionToken}, nil
+	})
+}
+
+//EnvCredentials provider of AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY & AWS_SESSION_TOKEN
+func EnvCredentials() CredentialsProvider {
+	return CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		creds := Credentials{
+			AccessKeyID:     firstEnv("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY"),
+			SecretAccessKey: firstEnv("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if len(creds.AccessKeyID) == 0 || len(creds.SecretAccessKey) == 0 {
+			return Credentials{}, errors.New("sigv4: AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY not set")
+		}
+		return creds, nil
+	})
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+//ProfileCredentials provider of the shared credentials file, read for every signing so rotated keys are picked up.
+//An empty filename is AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials, an empty profile is AWS_PROFILE or "default".
+func ProfileCredentials(filename string, profile string) CredentialsProvider {
+	return CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		name := filename
+		if len(name) == 0 {
+			name = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+		}
+		if len(name) == 0 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return Credentials{}, errors.Annotate(err, "sigv4: credentials file")
+			}
+			name = filepath.Join(home, ".aws", "credentials")
+		}
+		section := profile
+		if len(section) == 0 {
+			section = firstEnv("AWS_PROFILE")
+		}
+		if len(section) == 0 {
+			section = "default"
+		}
+		return readProfile(name, section)
+	})
+}
+
+func readProfile(filename string, profile string) (Credentials, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return Credentials{}, errors.Annotate(err, "sigv4: credentials file")
+	}
+	defer fd.Close()
+	creds, found, current := Credentials{}, false, ""
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(strings.TrimPrefix(strings.Trim(line, "[]"), "profile "))
+			found = found || current == profile
+			continue
+		}
+		if current != profile {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.TrimSpace(kv[1])
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = v
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = v
+		case "aws_session_token":
+			creds.SessionToken = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, errors.Annotate(err, "sigv4: credentials file")
+	}
+	if !found {
+		return Credentials{}, errors.Errorf("sigv4: profile %s not found in %s", profile, filename)
+	}
+	if len(creds.AccessKeyID) == 0 || len(creds.SecretAccessKey) == 0 {
+		return Credentials{}, errors.Errorf("sigv4: profile %s without aws_access_key_id or aws_secret_access_key", profile)
+	}
+	return creds, nil
+}
@@ -0,0 +1,414 @@
+package sigv4
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/x-mod/errors"
+	"github.com/x-mod/httpclient"
+)
+
+//payload hashes of the x-amz-content-sha256 header
+const (
+	UnsignedPayloadHash  = "UNSIGNED-PAYLOAD"
+	StreamingPayloadHash = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+)
+
+//DefaultChunkSize of the streaming payload
+const DefaultChunkSize = 64 * 1024
+
+const (
+	algorithm   = "AWS4-HMAC-SHA256"
+	timeFormat  = "20060102T150405Z"
+	dateFormat  = "20060102"
+	emptyHash   = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	chunkSigLen = 64
+)
+
+//headers never signed, they may be changed on the way
+var ignoredHeaders = map[string]bool{
+	"authorization":     true,
+	"user-agent":        true,
+	"x-amzn-trace-id":   true,
+	"expect":            true,
+	"transfer-encoding": true,
+	"host":              true,
+}
+
+type payloadMode int
+
+const (
+	signedPayload payloadMode = iota
+	unsignedPayload
+	streamingPayload
+)
+
+//Signer of AWS Signature Version 4, implemention of httpclient.Signer.
+//The service "s3" keeps the path escaped once & always sends the x-amz-content-sha256 header.
+type Signer struct {
+	credentials CredentialsProvider
+	region      string
+	service     string
+	payload     payloadMode
+	chunkSize   int
+	now         func() time.Time
+}
+
+//Opt of signer
+type Opt func(*Signer)
+
+//UnsignedPayload opt, the payload is not hashed, eg. for large uploads over tls
+func UnsignedPayload() Opt {
+	return func(s *Signer) {
+		s.payload = unsignedPayload
+	}
+}
+
+//StreamingPayload opt, the payload is sent in aws-chunked encoding of the chunk size, each chunk signed.
+//The request must have a known content length.
+func StreamingPayload(chunkSize int) Opt {
+	return func(s *Signer) {
+		s.payload = streamingPayload
+		s.chunkSize = chunkSize
+	}
+}
+
+//Clock opt, the time of signing
+func Clock(now func() time.Time) Opt {
+	return func(s *Signer) {
+		s.now = now
+	}
+}
+
+//New signer of the region & service, eg. "us-east-1" & "s3"
+func New(credentials CredentialsProvider, region string, service string, opts ...Opt) *Signer {
+	s := &Signer{
+		credentials: credentials,
+		region:      region,
+		service:     service,
+		chunkSize:   DefaultChunkSize,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.chunkSize <= 0 {
+		s.chunkSize = DefaultChunkSize
+	}
+	return s
+}
+
+var _ httpclient.Signer = &Signer{}
+
+//Sign implemention of httpclient.Signer, sign the request by the Authorization header
+func (s *Signer) Sign(ctx context.Context, req *http.Request) error {
+	creds, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	t := s.now().UTC()
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", t.Format(timeFormat))
+	if len(creds.SessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	payload := req.Header.Get("X-Amz-Content-Sha256")
+	streaming := false
+	if len(payload) == 0 {
+		switch {
+		case s.payload == unsignedPayload:
+			payload = UnsignedPayloadHash
+		case s.payload == streamingPayload && req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0:
+			if req.ContentLength < 0 {
+				return errors.New("sigv4: streaming payload requires the content length")
+			}
+			payload, streaming = StreamingPayloadHash, true
+			encoding := "aws-chunked"
+			if v := req.Header.Get("Content-Encoding"); len(v) > 0 {
+				encoding += "," + v
+			}
+			req.Header.Set("Content-Encoding", encoding)
+			req.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(req.ContentLength, 10))
+			req.ContentLength = chunkedLength(req.ContentLength, int64(s.chunkSize))
+			req.Header.Set("Content-Length", strconv.FormatInt(req.ContentLength, 10))
+		default:
+			if payload, err = payloadHash(req); err != nil {
+				return err
+			}
+		}
+		if s.service == "s3" || payload == UnsignedPayloadHash || streaming {
+			req.Header.Set("X-Amz-Content-Sha256", payload)
+		}
+	}
+
+	headers := http.Header{}
+	for k, v := range req.Header {
+		if !ignoredHeaders[strings.ToLower(k)] {
+			headers[k] = v
+		}
+	}
+	signature, signedHeaders, scope := s.signature(creds, t, req.Method, req.URL, host(req), headers, payload)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+
+	if streaming {
+		key := s.signingKey(creds, t)
+		newBody := func(body io.ReadCloser) io.ReadCloser {
+			return &chunkedBody{
+				body:  body,
+				key:   key,
+				date:  t.Format(timeFormat),
+				scope: scope,
+				prev:  signature,
+				chunk: make([]byte, s.chunkSize),
+			}
+		}
+		req.Body = newBody(req.Body)
+		if getBody := req.GetBody; getBody != nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				return newBody(body), nil
+			}
+		}
+	}
+	return nil
+}
+
+//Presign the url of the request valid for the expires, the signature is sent by the query.
+//Only the host & the x-amz-* headers of the request are signed.
+func (s *Signer) Presign(ctx context.Context, req *http.Request, expires time.Duration) (string, error) {
+	creds, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return "", err
+	}
+	t := s.now().UTC()
+	payload := UnsignedPayloadHash
+	if s.service != "s3" {
+		if payload, err = payloadHash(req); err != nil {
+			return "", err
+		}
+	}
+	headers := http.Header{}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") && lk != "x-amz-date" && lk != "x-amz-content-sha256" {
+			headers[k] = v
+		}
+	}
+	names := signedHeaderNames(headers)
+	u := *req.URL
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", algorithm)
+	q.Set("X-Amz-Credential", creds.AccessKeyID+"/"+s.scope(t))
+	q.Set("X-Amz-Date", t.Format(timeFormat))
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	q.Set("X-Amz-SignedHeaders", names)
+	if len(creds.SessionToken) > 0 {
+		q.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	u.RawQuery = canonicalQuery(q)
+	signature, _, _ := s.signature(creds, t, req.Method, &u, host(req), headers, payload)
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+//signature of the canonical request
+func (s *Signer) signature(creds Credentials, t time.Time, method string, u *url.URL, host string, headers http.Header, payload string) (signature string, signedHeaders string, scope string) {
+	scope = s.scope(t)
+	signedHeaders = signedHeaderNames(headers)
+	canonical := strings.Join([]string{
+		method,
+		s.canonicalURI(u),
+		canonicalQuery(u.Query()),
+		canonicalHeaders(host, headers),
+		signedHeaders,
+		payload,
+	}, "\n")
+	stringToSign := strings.Join([]string{algorithm, t.Format(timeFormat), scope, hashHex([]byte(canonical))}, "\n")
+	signature = hex.EncodeToString(hmacSHA256(s.signingKey(creds, t), stringToSign))
+	return
+}
+
+func (s *Signer) scope(t time.Time) string {
+	return strings.Join([]string{t.Format(dateFormat), s.region, s.service, "aws4_request"}, "/")
+}
+
+func (s *Signer) signingKey(creds Credentials, t time.Time) []byte {
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), t.Format(dateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+//canonicalURI the path escaped, twice except for s3
+func (s *Signer) canonicalURI(u *url.URL) string {
+	p := u.Path
+	if len(p) == 0 {
+		p = "/"
+	}
+	p = escape(p, false)
+	if s.service != "s3" {
+		p = escape(p, false)
+	}
+	return p
+}
+
+func canonicalQuery(q url.Values) string {
+	pairs := []string{}
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func signedHeaderNames(headers http.Header) string {
+	names := []string{"host"}
+	for k := range headers {
+		names = append(names, strings.ToLower(k))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
+
+func canonicalHeaders(host string, headers http.Header) string {
+	lines := []string{"host:" + host}
+	for k, vs := range headers {
+		values := make([]string, len(vs))
+		for i, v := range vs {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+		lines = append(lines, strings.ToLower(k)+":"+strings.Join(values, ","))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+//host of the request without the default port
+func host(req *http.Request) string {
+	h := req.Host
+	if len(h) == 0 {
+		h = req.URL.Host
+	}
+	if (req.URL.Scheme == "http" && strings.HasSuffix(h, ":80")) || (req.URL.Scheme == "https" && strings.HasSuffix(h, ":443")) {
+		h = h[:strings.LastIndex(h, ":")]
+	}
+	return h
+}
+
+//escape by RFC 3986, only the unreserved characters are kept, & the slash of the path
+func escape(s string, query bool) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !query) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+//payloadHash of a copy of the request body
+func payloadHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return emptyHash, nil
+	}
+	if req.GetBody == nil {
+		return "", errors.New("sigv4: the payload hash requires a replayable request body, or UnsignedPayload")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", errors.Annotate(err, "request body rewind")
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashHex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+//chunkedLength of the aws-chunked encoding
+func chunkedLength(length int64, chunkSize int64) int64 {
+	frame := func(n int64) int64 {
+		return int64(len(strconv.FormatInt(n, 16))) + int64(len(";chunk-signature=")) + chunkSigLen + 2 + n + 2
+	}
+	total := (length / chunkSize) * frame(chunkSize)
+	if rest := length % chunkSize; rest > 0 {
+		total += frame(rest)
+	}
+	return total + frame(0)
+}
+
+//chunkedBody aws-chunked encoding of the body, each chunk signed by the previous signature
+type chunkedBody struct {
+	body  io.ReadCloser
+	key   []byte
+	date  string
+	scope string
+	prev  string
+	chunk []byte
+	buf   bytes.Buffer
+	done  bool
+}
+
+func (c *chunkedBody) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 && !c.done {
+		n, err := io.ReadFull(c.body, c.chunk)
+		if n > 0 {
+			c.frame(c.chunk[:n])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.frame(nil)
+			c.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if c.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.buf.Read(p)
+}
+
+func (c *chunkedBody) frame(data []byte) {
+	stringToSign := strings.Join([]string{algorithm + "-PAYLOAD", c.date, c.scope, c.prev, emptyHash, hashHex(data)}, "\n")
+	c.prev = hex.EncodeToString(hmacSHA256(c.key, stringToSign))
+	fmt.Fprintf(&c.buf, "%x;chunk-signature=%s\r\n", len(data), c.prev)
+	c.buf.Write(data)
+	c.buf.WriteString("\r\n")
+}
+
+func (c *chunkedBody) Close() error {
+	return c.body.Close()
+}
@@ -0,0 +1,282 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/x-mod/errors"
+)
+
+//DefaultEventRetry reconnection delay of Subscribe, until the server sets one by the retry field
+var DefaultEventRetry = 3 * time.Second
+
+//DefaultEventReconnects max reconnections of Subscribe in a row without an event, negative is unlimited
+var DefaultEventReconnects = 10
+
+//ErrNotEventStream the response isn't text/event-stream
+var ErrNotEventStream = errors.New("not text/event-stream")
+
+//Event of text/event-stream
+type Event struct {
+	//ID last event id of the stream
+	ID string
+	//Event type, "message" by default
+	Event string
+	Data  string
+	//Retry reconnection time set by this event, zero if not set
+	Retry time.Duration
+}
+
+//EventHandler callback per event, the next event isn't read until it returns, an error stops the subscription
+type EventHandler func(ctx context.Context, event *Event) error
+
+//EventBackoff opt, delay between the reconnections of Subscribe, when it's longer than the server's retry interval
+func EventBackoff(backoff BackoffFunc) Opt {
+	return func(cf *config) {
+		cf.eventBackoff = backoff
+	}
+}
+
+//EventReconnects opt, max reconnections of Subscribe in a row without an event, negative is unlimited
+func EventReconnects(reconnects int) Opt {
+	return func(cf *config) {
+		cf.eventReconnects = reconnects
+	}
+}
+
+//Subscribe to a text/event-stream (Server-Sent Events) & invoke the handler per event.
+//The stream is requested by Client.DoRequest, with the client's auth, proxies, tls & read limits,
+//but not limited by the client's Timeout. When the stream ends or breaks, it reconnects with the Last-Event-ID
+//header after the server's retry interval, or the EventBackoff if it's longer. It returns when the context is done,
+//the handler fails, the server responds 204 No Content, rejects the stream (*StatusError, ErrNotEventStream),
+//a line is longer than DefaultMaxLineSize (bufio.ErrTooLong), or the EventReconnects are exhausted,
+//with the last connection error.
+func (c *Client) Subscribe(ctx context.Context, handler EventHandler, opts ...ReqOpt) error {
+	sub := &subscription{
+		client:  c,
+		handler: handler,
+		opts:    opts,
+		retry:   DefaultEventRetry,
+	}
+	attempt := 0
+	for {
+		received, err := sub.connect(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if received {
+			attempt = 0
+		}
+		attempt++
+		if n := c.config.eventReconnects; n >= 0 && attempt > n {
+			if sub.err != nil {
+				return errors.Errorf("subscribe: %d reconnects failed: %w", n, sub.err)
+			}
+			return errors.Errorf("subscribe: %d reconnects without an event", n)
+		}
+		delay := sub.retry
+		if c.config.eventBackoff != nil {
+			if d := c.config.eventBackoff(attempt); d > delay {
+				delay = d
+			}
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+//Events subscribe to a text/event-stream, the events are sent over the channel until the subscription ends,
+//then the error channel receives the reason & both channels are closed
+func (c *Client) Events(ctx context.Context, opts ...ReqOpt) (<-chan *Event, <-chan error) {
+	events := make(chan *Event)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(events)
+		errs <- c.Subscribe(ctx, func(ctx context.Context, event *Event) error {
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, opts...)
+	}()
+	return events, errs
+}
+
+type subscription struct {
+	client      *Client
+	handler     EventHandler
+	opts        []ReqOpt
+	lastEventID string
+	retry       time.Duration
+	//err of the last connection, reconnected
+	err error
+}
+
+//connect read the stream until it ends, a non-nil error stops reconnecting
+func (s *subscription) connect(ctx context.Context) (bool, error) {
+	req, err := s.client.MakeRequest(s.opts...)
+	if err != nil {
+		return false, err
+	}
+	requestOptionsFrom(req.Context()).stream = true
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if len(s.lastEventID) > 0 {
+		req.Header.Set("Last-Event-ID", s.lastEventID)
+	}
+	rsp, err := s.client.DoRequest(ctx, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		//reconnect on network errors
+		s.err = err
+		return false, nil
+	}
+	defer drainBody(rsp.Body)
+	//server asks to stop reconnecting
+	if rsp.StatusCode == http.StatusNoContent {
+		return false, io.EOF
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return false, responseError(rsp)
+	}
+	if mt, _, _ := mime.ParseMediaType(rsp.Header.Get("Content-Type")); mt != "text/event-stream" {
+		return false, ErrNotEventStream
+	}
+
+	defer closeOnDone(ctx, rsp.Body)()
+
+	received := false
+	err = parseEvents(rsp.Body, func(field string, value string) {
+		switch field {
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}, func(event *Event) error {
+		received = true
+		event.ID = s.lastEventID
+		return s.handler(ctx, event)
+	})
+	if ctx.Err() != nil {
+		return received, ctx.Err()
+	}
+	if herr, ok := err.(*handlerError); ok {
+		return received, herr.err
+	}
+	//the stream can't be parsed, reconnecting would fail the same
+	if err == bufio.ErrTooLong {
+		return received, err
+	}
+	//reconnect when the stream ends or breaks
+	s.err = err
+	return received, nil
+}
+
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+//parseEvents of the stream (https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation),
+//field is invoked per id & retry field, dispatch per complete event
+func parseEvents(rd io.Reader, field func(name string, value string), dispatch func(*Event) error) error {
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 0, 4096), DefaultMaxLineSize)
+	scanner.Split(scanEventLines)
+	event := &Event{}
+	data := &bytes.Buffer{}
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		if len(line) == 0 {
+			//dispatch
+			if data.Len() > 0 {
+				event.Data = strings.TrimSuffix(data.String(), "\n")
+				if len(event.Event) == 0 {
+					event.Event = "message"
+				}
+				if err := dispatch(event); err != nil {
+					return &handlerError{err: err}
+				}
+			}
+			event = &Event{}
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		name, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			name, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch name {
+		case "event":
+			event.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			field(name, value)
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				event.Retry = time.Duration(ms) * time.Millisecond
+				field(name, value)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+//scanEventLines split lines ended by CRLF, LF or CR
+func scanEventLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		//CR at the end of data, wait for a possible LF
+		return 0, nil, nil
+	}
+	//an incomplete event at the end of stream is discarded
+	if atEOF && len(data) > 0 {
+		return len(data), nil, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,155 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	json "github.com/json-iterator/go"
+	"github.com/x-mod/errors"
+)
+
+//DefaultMaxLineSize max bytes of a streamed json item
+var DefaultMaxLineSize = 1 << 20
+
+//ErrInvalidJSON a streamed item isn't valid json
+var ErrInvalidJSON = errors.New("invalid json")
+
+//StreamItem a json item of a stream
+type StreamItem struct {
+	//Record number of the item in the stream, from 1: the line of ndjson, the RS record of json-seq
+	Record int
+	//Raw json of the item, only valid until the callback returns
+	Raw []byte
+}
+
+//Decode the item into obj
+func (it *StreamItem) Decode(obj interface{}) error {
+	return json.Unmarshal(it.Raw, obj)
+}
+
+//StreamFunc callback per item, the next item isn't read until it returns, an error stops the stream
+type StreamFunc func(ctx context.Context, item *StreamItem) error
+
+//StreamError error of a stream item
+type StreamError struct {
+	//Record number of the item, like StreamItem.Record
+	Record int
+	Err    error
+}
+
+//Error implemention
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream record %d: %v", e.Record, e.Err)
+}
+
+//Cause implemention
+func (e *StreamError) Cause() error {
+	return e.Err
+}
+
+//Unwrap implemention
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+type streamProcessor struct {
+	fn          StreamFunc
+	maxLineSize int
+}
+
+//StreamOpt option of StreamJSON
+type StreamOpt func(*streamProcessor)
+
+//MaxLineSize max bytes of an item, DefaultMaxLineSize by default
+func MaxLineSize(size int) StreamOpt {
+	return func(sp *streamProcessor) {
+		sp.maxLineSize = size
+	}
+}
+
+//StreamJSON processor, decode the application/x-ndjson or RFC 7464 application/json-seq response
+//item by item without buffering the whole body, the callback is invoked per item
+func StreamJSON(fn StreamFunc, opts ...StreamOpt) ResponseProcessor {
+	sp := &streamProcessor{fn: fn, maxLineSize: DefaultMaxLineSize}
+	for _, opt := range opts {
+		opt(sp)
+	}
+	return sp
+}
+
+//Process implemention of ResponseProcessor
+func (sp *streamProcessor) Process(ctx context.Context, rsp *http.Response) error {
+	defer drainBody(rsp.Body)
+	if !success(rsp) {
+		return responseError(rsp)
+	}
+	defer closeOnDone(ctx, rsp.Body)()
+
+	scanner := bufio.NewScanner(rsp.Body)
+	size := 4096
+	if sp.maxLineSize < size {
+		size = sp.maxLineSize
+	}
+	scanner.Buffer(make([]byte, 0, size), sp.maxLineSize)
+	if mt, _, _ := mime.ParseMediaType(rsp.Header.Get("Content-Type")); mt == "application/json-seq" {
+		scanner.Split(scanRecords)
+	}
+	record := 0
+	for scanner.Scan() {
+		record++
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if !json.Valid(raw) {
+			return &StreamError{Record: record, Err: ErrInvalidJSON}
+		}
+		if err := sp.fn(ctx, &StreamItem{Record: record, Raw: raw}); err != nil {
+			return &StreamError{Record: record, Err: err}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := scanner.Err(); err != nil {
+		return &StreamError{Record: record + 1, Err: err}
+	}
+	return nil
+}
+
+//closeOnDone close the body to unblock the reading when the context is done, until the returned stop is called
+func closeOnDone(ctx context.Context, body io.Closer) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			body.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+//scanRecords split RFC 7464 records, each one starts with RS (0x1E)
+func scanRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	const rs = 0x1E
+	start := 0
+	if len(data) > 0 && data[0] == rs {
+		start = 1
+	}
+	if i := bytes.IndexByte(data[start:], rs); i >= 0 {
+		return start + i, data[start : start+i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data[start:], nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,349 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+//phases of TimeoutError
+const (
+	PhaseDNS            = "dns"
+	PhaseConnect        = "connect"
+	PhaseTLSHandshake   = "tls handshake"
+	PhaseResponseHeader = "response header"
+	PhaseBodyRead       = "body read"
+	PhaseAttempt        = "attempt"
+	PhaseRequest        = "request"
+)
+
+//TimeoutError the phase of the request timed out, matches context.DeadlineExceeded by errors.Is
+type TimeoutError struct {
+	Phase string
+	//After the timeout of the phase
+	After time.Duration
+	Err   error
+}
+
+//Error implemention
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout after %s: %v", e.Phase, e.After, e.Err)
+}
+
+//Timeout implemention of net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+//Temporary implemention of net.Error
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+//Unwrap implemention
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+//Is context.DeadlineExceeded
+func (e *TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+type timeoutConfig struct {
+	request      time.Duration
+	attempt      time.Duration
+	dns          time.Duration
+	connect      time.Duration
+	tlsHandshake time.Duration
+	header       time.Duration
+	body         time.Duration
+}
+
+func (tc timeoutConfig) phases() bool {
+	return tc.attempt > 0 || tc.dns > 0 || tc.connect > 0 || tc.tlsHandshake > 0 || tc.header > 0 || tc.body > 0
+}
+
+//TimeoutOpt deadline of a phase of the request, zero is unlimited
+type TimeoutOpt func(*timeoutConfig)
+
+//AttemptTimeout deadline of each attempt of the retries, including reading the body
+func AttemptTimeout(timeout time.Duration) TimeoutOpt {
+	return func(tc *timeoutConfig) {
+		tc.attempt = timeout
+	}
+}
+
+//DNSTimeout deadline of the dns lookup
+func DNSTimeout(timeout time.Duration) TimeoutOpt {
+	return func(tc *timeoutConfig) {
+		tc.dns = timeout
+	}
+}
+
+//ConnectTimeout deadline of the tcp connect, it's the dialer timeout too (the client's Timeout by default)
+func ConnectTimeout(timeout time.Duration) TimeoutOpt {
+	return func(tc *timeoutConfig) {
+		tc.connect = timeout
+	}
+}
+
+//TLSHandshakeTimeout deadline of the tls handshake
+func TLSHandshakeTimeout(timeout time.Duration) TimeoutOpt {
+	return func(tc *timeoutConfig) {
+		tc.tlsHandshake = timeout
+	}
+}
+
+//ResponseHeaderTimeout deadline of the response headers, after the request is written
+func ResponseHeaderTimeout(timeout time.Duration) TimeoutOpt {
+	return func(tc *timeoutConfig) {
+		tc.header = timeout
+	}
+}
+
+//BodyReadTimeout deadline of reading the whole response body, after the headers are received
+func BodyReadTimeout(timeout time.Duration) TimeoutOpt {
+	return func(tc *timeoutConfig) {
+		tc.body = timeout
+	}
+}
+
+//Timeouts opt, the phase deadlines of every request, a phase timed out fails with a *TimeoutError
+func Timeouts(opts ...TimeoutOpt) Opt {
+	return func(cf *config) {
+		cf.timeoutOpts = append(cf.timeoutOpts, opts...)
+	}
+}
+
+//RequestTimeouts opt, the phase deadlines of the request, override the client's Timeouts
+func RequestTimeouts(opts ...TimeoutOpt) ReqOpt {
+	return func(cf *requestConfig) {
+		cf.options.timeouts = append(cf.options.timeouts, opts...)
+	}
+}
+
+//RequestTimeout opt, overall deadline of the request across the retries, including reading the body
+func RequestTimeout(timeout time.Duration) ReqOpt {
+	return func(cf *requestConfig) {
+		cf.options.timeouts = append(cf.options.timeouts, func(tc *timeoutConfig) {
+			tc.request = timeout
+		})
+	}
+}
+
+func newTimeoutConfig(opts ...[]TimeoutOpt) timeoutConfig {
+	tc := timeoutConfig{}
+	for _, group := range opts {
+		for _, opt := range group {
+			opt(&tc)
+		}
+	}
+	return tc
+}
+
+//timeouts of the client & the request, the client's Timeout is the attempt deadline when none is set
+func (c *Client) timeouts(req *http.Request) timeoutConfig {
+	tc := newTimeoutConfig(c.config.timeoutOpts)
+	options := requestOptionsFrom(req.Context())
+	if options != nil {
+		tc = newTimeoutConfig(c.config.timeoutOpts, options.timeouts)
+	}
+	if c.config.client == nil && tc.request <= 0 && !tc.phases() && (options == nil || !options.stream) {
+		tc.attempt = c.config.timeout
+	}
+	return tc
+}
+
+//attemptOnce do the request once within the phase deadlines
+func (c *Client) attemptOnce(ctx context.Context, req *http.Request, tc timeoutConfig) (*http.Response, error) {
+	client, err := c.httpClient(req)
+	if err != nil {
+		return nil, err
+	}
+	if !tc.phases() {
+		rsp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, c.proxyError(req, err)
+		}
+		rsp.Body = c.guardBody(req, rsp.Body)
+		return rsp, nil
+	}
+	actx, cancel := context.WithCancel(ctx)
+	if tc.attempt > 0 {
+		actx, cancel = context.WithTimeout(ctx, tc.attempt)
+	}
+	pt := &phaseTimer{config: tc, cancel: cancel, timers: make(map[string]*time.Timer)}
+	rsp, err := client.Do(req.WithContext(httptrace.WithClientTrace(actx, pt.trace())))
+	if err != nil {
+		pt.stopAll()
+		cancel()
+		return nil, pt.timeoutError(ctx, actx, c.proxyError(req, err))
+	}
+	pt.start(PhaseBodyRead, tc.body)
+	rsp.Body = &attemptBody{ReadCloser: c.guardBody(req, rsp.Body), timer: pt, ctx: ctx, actx: actx, cancel: cancel}
+	return rsp, nil
+}
+
+type phaseTimer struct {
+	config   timeoutConfig
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+	timers   map[string]*time.Timer
+	connects int
+	phase    string
+	timeout  time.Duration
+}
+
+func (p *phaseTimer) start(phase string, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.timers[phase]; ok || len(p.phase) > 0 {
+		return
+	}
+	p.timers[phase] = time.AfterFunc(timeout, func() {
+		p.mu.Lock()
+		if len(p.phase) == 0 {
+			p.phase, p.timeout = phase, timeout
+		}
+		p.mu.Unlock()
+		p.cancel()
+	})
+}
+
+func (p *phaseTimer) stop(phase string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.timers[phase]; ok {
+		t.Stop()
+		delete(p.timers, phase)
+	}
+}
+
+func (p *phaseTimer) stopAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for phase, t := range p.timers {
+		t.Stop()
+		delete(p.timers, phase)
+	}
+}
+
+func (p *phaseTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			p.start(PhaseDNS, p.config.dns)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			p.stop(PhaseDNS)
+		},
+		ConnectStart: func(network, addr string) {
+			p.mu.Lock()
+			p.connects++
+			p.mu.Unlock()
+			p.start(PhaseConnect, p.config.connect)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			p.mu.Lock()
+			p.connects--
+			n := p.connects
+			p.mu.Unlock()
+			//the parallel dials of the addresses (RFC 6555) are done
+			if n <= 0 {
+				p.stop(PhaseConnect)
+			}
+		},
+		TLSHandshakeStart: func() {
+			p.start(PhaseTLSHandshake, p.config.tlsHandshake)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			p.stop(PhaseTLSHandshake)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			p.start(PhaseResponseHeader, p.config.header)
+		},
+		GotFirstResponseByte: func() {
+			p.stop(PhaseResponseHeader)
+		},
+	}
+}
+
+//error of the attempt, a *TimeoutError if a phase or the attempt timed out
+func (p *phaseTimer) timeoutError(ctx context.Context, actx context.Context, err error) error {
+	p.mu.Lock()
+	phase, timeout := p.phase, p.timeout
+	p.mu.Unlock()
+	if len(phase) > 0 {
+		return &TimeoutError{Phase: phase, After: timeout, Err: err}
+	}
+	if actx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return &TimeoutError{Phase: PhaseAttempt, After: p.config.attempt, Err: err}
+	}
+	return err
+}
+
+type attemptBody struct {
+	io.ReadCloser
+	timer  *phaseTimer
+	ctx    context.Context
+	actx   context.Context
+	cancel context.CancelFunc
+}
+
+func (b *attemptBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.timer.stop(PhaseBodyRead)
+	} else if err != nil {
+		err = b.timer.timeoutError(b.ctx, b.actx, err)
+	}
+	return n, err
+}
+
+func (b *attemptBody) Close() error {
+	b.timer.stopAll()
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+//requestBody cancel the request's deadline when the body is closed
+type requestBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	rctx    context.Context
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = requestTimeoutError(b.ctx, b.rctx, b.timeout, err)
+	}
+	return n, err
+}
+
+func (b *requestBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func requestTimeoutError(ctx context.Context, rctx context.Context, timeout time.Duration, err error) error {
+	if _, ok := err.(*TimeoutError); ok {
+		return err
+	}
+	if rctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return &TimeoutError{Phase: PhaseRequest, After: timeout, Err: err}
+	}
+	return err
+}
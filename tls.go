@@ -0,0 +1,309 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/x-mod/errors"
+)
+
+//DefaultTLSReloadInterval default interval of checking the tls files
+var DefaultTLSReloadInterval = 30 * time.Second
+
+type tlsReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	interval time.Duration
+	expiry   func(cert *x509.Certificate, remaining time.Duration)
+	onError  func(err error)
+
+	//verifying the server by the CA bundle
+	verifying bool
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	leaf    *x509.Certificate
+	roots   *x509.CertPool
+	err     error
+	modTime map[string]time.Time
+	stop    chan struct{}
+	once    sync.Once
+}
+
+//TLSReloadOpt of ReloadingTLS
+type TLSReloadOpt func(*tlsReloader)
+
+//TLSReloadInterval opt, the interval of checking the files for changes
+func TLSReloadInterval(d time.Duration) TLSReloadOpt {
+	return func(r *tlsReloader) {
+		if d > 0 {
+			r.interval = d
+		}
+	}
+}
+
+//TLSExpiry opt, report the client certificate & its remaining validity after each load & check, eg. to a metric
+func TLSExpiry(fn func(cert *x509.Certificate, remaining time.Duration)) TLSReloadOpt {
+	return func(r *tlsReloader) {
+		r.expiry = fn
+	}
+}
+
+//TLSReloadError opt, report the load errors, the certificates loaded before are kept in use
+func TLSReloadError(fn func(err error)) TLSReloadOpt {
+	return func(r *tlsReloader) {
+		r.onError = fn
+	}
+}
+
+//ReloadingTLS opt, the client certificate & key and the CA bundle are loaded from the files, which are
+//checked for changes & swapped in for the new connections, the pooled connections are kept.
+//The TLSConfig opt is the base config. An empty certFile sends no client certificate,
+//an empty caFile verifies the server by the system roots. Checking is stopped by Client.Close.
+//With a caFile, the servers of ip addresses are verified only when connected directly, not through the proxies.
+func ReloadingTLS(certFile string, keyFile string, caFile string, opts ...TLSReloadOpt) Opt {
+	return func(cf *config) {
+		r := &tlsReloader{
+			certFile: certFile,
+			keyFile:  keyFile,
+			caFile:   caFile,
+			interval: DefaultTLSReloadInterval,
+			modTime:  make(map[string]time.Time),
+			stop:     make(chan struct{}),
+		}
+		for _, opt := range opts {
+			opt(r)
+		}
+		cf.tlsReloader = r
+	}
+}
+
+//config of the base, getting the certificate & verifying the server by the loaded files
+func (r *tlsReloader) config(base *tls.Config) *tls.Config {
+	cfg := &tls.Config{}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	if len(r.certFile) > 0 {
+		cfg.Certificates = nil
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			if r.cert == nil {
+				return nil, r.err
+			}
+			return r.cert, nil
+		}
+	}
+	if len(r.caFile) > 0 && !cfg.InsecureSkipVerify {
+		//the direct connections are verified by the handshake of dialTLS, the others (eg. in the proxy
+		//tunnels) by VerifyConnection against the current roots
+		r.verifying = true
+		cfg.InsecureSkipVerify = true
+		verify := cfg.VerifyConnection
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.VerifiedChains) == 0 {
+				if err := r.verify(cs); err != nil {
+					return err
+				}
+			}
+			if verify != nil {
+				return verify(cs)
+			}
+			return nil
+		}
+	}
+	return cfg
+}
+
+//currentRoots the loaded CA bundle
+func (r *tlsReloader) currentRoots() (*x509.CertPool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.roots == nil {
+		return nil, errors.Errorf("tls ca bundle not loaded: %w", r.err)
+	}
+	return r.roots, nil
+}
+
+//verify the server of the name (SNI), the ip addresses are not sent as SNI & can't be verified here
+func (r *tlsReloader) verify(cs tls.ConnectionState) error {
+	roots, err := r.currentRoots()
+	if err != nil {
+		return err
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls server certificate missing")
+	}
+	if len(cs.ServerName) == 0 {
+		return errors.New("tls server name missing, the ip address is verified only when connected directly")
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+//dialTLS the direct tls connections, verified by the handshake against the current roots & the dialed host
+func (r *tlsReloader) dialTLS(tr *http.Transport) DialContext {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		roots, err := r.currentRoots()
+		if err != nil {
+			return nil, err
+		}
+		conn, err := tr.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := tr.TLSClientConfig.Clone()
+		if len(cfg.ServerName) == 0 {
+			cfg.ServerName = host
+		}
+		cfg.RootCAs, cfg.InsecureSkipVerify = roots, false
+		if tr.TLSHandshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tr.TLSHandshakeTimeout)
+			defer cancel()
+		}
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		tc := tls.Client(conn, cfg)
+		err = tc.HandshakeContext(ctx)
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(tc.ConnectionState(), err)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+}
+
+//start load the files & check them in the background
+func (r *tlsReloader) start() {
+	r.reload()
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.reload()
+			}
+		}
+	}()
+}
+
+func (r *tlsReloader) close() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+}
+
+//reload the files changed
+func (r *tlsReloader) reload() {
+	changed := false
+	for _, name := range []string{r.certFile, r.keyFile, r.caFile} {
+		if len(name) == 0 {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			r.fail(errors.Annotate(err, "tls reload"))
+			return
+		}
+		if !info.ModTime().Equal(r.modTime[name]) {
+			changed = true
+		}
+	}
+	if changed {
+		if err := r.load(); err != nil {
+			r.fail(err)
+			return
+		}
+	}
+	r.mu.RLock()
+	leaf := r.leaf
+	r.mu.RUnlock()
+	if leaf != nil && r.expiry != nil {
+		r.expiry(leaf, time.Until(leaf.NotAfter))
+	}
+}
+
+func (r *tlsReloader) load() error {
+	modTime := make(map[string]time.Time)
+	for _, name := range []string{r.certFile, r.keyFile, r.caFile} {
+		if len(name) > 0 {
+			info, err := os.Stat(name)
+			if err != nil {
+				return errors.Annotate(err, "tls reload")
+			}
+			modTime[name] = info.ModTime()
+		}
+	}
+	var cert *tls.Certificate
+	var leaf *x509.Certificate
+	if len(r.certFile) > 0 {
+		loaded, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return errors.Annotatef(err, "tls reload certificate %s & key %s", r.certFile, r.keyFile)
+		}
+		cert = &loaded
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return errors.Annotate(err, "tls reload")
+		}
+		leaf = parsed
+		cert.Leaf = leaf
+	}
+	var roots *x509.CertPool
+	if len(r.caFile) > 0 {
+		b, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return errors.Annotate(err, "tls reload")
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(b) {
+			return errors.Errorf("tls reload: no certificate in %s", r.caFile)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.leaf, r.roots, r.err = cert, leaf, roots, nil
+	r.modTime = modTime
+	return nil
+}
+
+//fail keep the loaded certificates, the error is returned only when nothing is loaded
+func (r *tlsReloader) fail(err error) {
+	r.mu.Lock()
+	r.err = err
+	r.mu.Unlock()
+	if r.onError != nil {
+		r.onError(err)
+	}
+}
@@ -0,0 +1,251 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func (c *testCert) tls() tls.Certificate {
+	pair, _ := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	return pair
+}
+
+//newTestCert signed by the parent, self-signed for a nil parent, of the hosts, 127.0.0.1 & localhost by default
+func newTestCert(t *testing.T, cn string, parent *testCert, validity time.Duration, hosts ...string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	if len(hosts) > 0 {
+		tmpl.IPAddresses, tmpl.DNSNames = nil, nil
+		for _, host := range hosts {
+			if ip := net.ParseIP(host); ip != nil {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			} else {
+				tmpl.DNSNames = append(tmpl.DNSNames, host)
+			}
+		}
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestReloadingTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, 24*time.Hour)
+	server := newTestCert(t, "server", ca, 24*time.Hour)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "close")
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{server.tls()}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	dir, _ := ioutil.TempDir("", "tls")
+	defer os.RemoveAll(dir)
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	write := func(c *testCert, mtime time.Time) {
+		ioutil.WriteFile(certFile, c.certPEM, 0600)
+		ioutil.WriteFile(keyFile, c.keyPEM, 0600)
+		os.Chtimes(certFile, mtime, mtime)
+		os.Chtimes(keyFile, mtime, mtime)
+	}
+	write(newTestCert(t, "one", ca, 24*time.Hour), time.Now().Add(-time.Minute))
+	ioutil.WriteFile(caFile, ca.certPEM, 0600)
+
+	var remaining int64
+	client := New(BaseURL(ts.URL), ReloadingTLS(certFile, keyFile, caFile,
+		TLSReloadInterval(10*time.Millisecond),
+		TLSExpiry(func(cert *x509.Certificate, d time.Duration) {
+			atomic.StoreInt64(&remaining, int64(d))
+		})))
+	defer client.Close()
+	get := func() (string, error) {
+		captured := &Captured{}
+		req, err := client.MakeRequest()
+		if err != nil {
+			return "", err
+		}
+		err = client.Execute(context.TODO(), req, Capture(captured))
+		return string(captured.Body), err
+	}
+	cn, err := get()
+	assert.Nil(t, err)
+	assert.Equal(t, "one", cn)
+	assert.True(t, time.Duration(atomic.LoadInt64(&remaining)) > 23*time.Hour)
+
+	//rotated on disk, swapped in for the new connections
+	write(newTestCert(t, "two", ca, 2*time.Hour), time.Now())
+	assert.Eventually(t, func() bool {
+		cn, err := get()
+		return err == nil && cn == "two"
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return time.Duration(atomic.LoadInt64(&remaining)) < 3*time.Hour
+	}, time.Second, 10*time.Millisecond)
+
+	//a broken file is reported, the loaded certificate is kept
+	errs := make(chan error, 1)
+	broken := New(BaseURL(ts.URL), ReloadingTLS(certFile, keyFile, caFile, TLSReloadInterval(10*time.Millisecond),
+		TLSReloadError(func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		})))
+	defer broken.Close()
+	ioutil.WriteFile(keyFile, []byte("broken"), 0600)
+	//the cause of the key pair
+	err = <-errs
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "PEM data")
+	}
+	client = broken
+	cn, err = get()
+	assert.Nil(t, err)
+	assert.Equal(t, "two", cn)
+
+	//the server of another name signed by the ca
+	mismatched := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mismatched.TLS = &tls.Config{Certificates: []tls.Certificate{newTestCert(t, "other", ca, time.Hour, "other.example").tls()}}
+	mismatched.StartTLS()
+	defer mismatched.Close()
+	for _, u := range []string{mismatched.URL, strings.Replace(mismatched.URL, "127.0.0.1", "localhost", 1)} {
+		client = New(BaseURL(u), ReloadingTLS("", "", caFile))
+		_, err = get()
+		assert.NotNil(t, err, u)
+		client.Close()
+	}
+}
+
+func TestPublicKeyPins(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, 24*time.Hour)
+	server := newTestCert(t, "server", ca, 24*time.Hour)
+	other := newTestCert(t, "other", nil, 24*time.Hour)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{server.tls()}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	get := func(opts ...PinOpt) error {
+		client := New(BaseURL(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)), TLSConfig(&tls.Config{RootCAs: pool}), PublicKeyPins(opts...))
+		defer client.Close()
+		req, err := client.MakeRequest()
+		if err != nil {
+			return err
+		}
+		return client.Execute(context.TODO(), req, ExpectStatus())
+	}
+	//the leaf, the backup or the ca
+	assert.Nil(t, get(Pin("localhost", "sha256/"+SPKIHash(server.cert))))
+	assert.Nil(t, get(Pin("localhost", SPKIHash(other.cert), SPKIHash(ca.cert))))
+	assert.Nil(t, get(Pin("*.example.com", SPKIHash(other.cert))))
+
+	err := get(Pin("localhost", SPKIHash(other.cert)))
+	assert.True(t, errors.Is(err, ErrPinMismatch))
+	pinErr := &PinError{}
+	if assert.True(t, errors.As(err, &pinErr)) {
+		assert.Equal(t, "localhost", pinErr.Host)
+		if assert.Len(t, pinErr.Chain, 1) {
+			assert.Equal(t, "server", pinErr.Chain[0].Subject.CommonName)
+		}
+	}
+
+	var reported *PinError
+	assert.Nil(t, get(Pin("localhost", SPKIHash(other.cert)), PinReportOnly(func(err *PinError) { reported = err })))
+	assert.NotNil(t, reported)
+
+	//the servers dialed by ip are pinned by the ServerName only
+	ipGet := func(cfg *tls.Config, opts ...PinOpt) error {
+		client := New(BaseURL(ts.URL), TLSConfig(cfg), PublicKeyPins(opts...))
+		defer client.Close()
+		req, err := client.MakeRequest()
+		if err != nil {
+			return err
+		}
+		return client.Execute(context.TODO(), req, ExpectStatus())
+	}
+	assert.Nil(t, ipGet(&tls.Config{RootCAs: pool}, Pin("127.0.0.1", SPKIHash(other.cert))))
+	err = ipGet(&tls.Config{RootCAs: pool, ServerName: "localhost"}, Pin("localhost", SPKIHash(other.cert)))
+	assert.True(t, errors.Is(err, ErrPinMismatch))
+
+	//the pinned ca appended to a chain of another trusted ca
+	evil := newTestCert(t, "evil", nil, 24*time.Hour)
+	leaf := newTestCert(t, "leaf", evil, 24*time.Hour)
+	chained := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	chained.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.cert.Raw, ca.cert.Raw}, PrivateKey: leaf.key}}}
+	chained.StartTLS()
+	defer chained.Close()
+	dir, _ := ioutil.TempDir("", "pin")
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, evil.certPEM, 0600)
+	for _, opt := range []Opt{ReloadingTLS("", "", caFile), TLSConfig(&tls.Config{InsecureSkipVerify: true})} {
+		client := New(BaseURL(strings.Replace(chained.URL, "127.0.0.1", "localhost", 1)), opt, PublicKeyPins(Pin("localhost", SPKIHash(ca.cert))))
+		req, _ := client.MakeRequest()
+		err = client.Execute(context.TODO(), req, ExpectStatus())
+		assert.True(t, errors.Is(err, ErrPinMismatch))
+		client.Close()
+	}
+
+	pc := &pinConfig{pins: make(map[string][]string)}
+	Pin("*.example.com", "a")(pc)
+	Pin("api.example.com", "b")(pc)
+	assert.Equal(t, []string{"a"}, pc.pinsOf("x.y.example.com"))
+	assert.Equal(t, []string{"b"}, pc.pinsOf("API.example.com"))
+	assert.Nil(t, pc.pinsOf("example.com"))
+}
@@ -0,0 +1,265 @@
+package httpclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/x-mod/errors"
+)
+
+//message types of WebSocketConn
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+)
+
+var (
+	//DefaultPingInterval keepalive ping interval of WebSocketConn, the peer must answer within two intervals
+	DefaultPingInterval = 30 * time.Second
+	//DefaultCloseTimeout max wait for the peer's close frame of the close handshake
+	DefaultCloseTimeout = 5 * time.Second
+)
+
+type websocketConfig struct {
+	subprotocols []string
+	compression  bool
+	pingInterval *time.Duration
+}
+
+//Subprotocols opt of DialWebSocket, the protocols offered in preference order
+func Subprotocols(protocols ...string) ReqOpt {
+	return func(cf *requestConfig) {
+		cf.websocket.subprotocols = append(cf.websocket.subprotocols, protocols...)
+	}
+}
+
+//PerMessageDeflate opt of DialWebSocket, negotiate the permessage-deflate extension (RFC 7692)
+func PerMessageDeflate(flag bool) ReqOpt {
+	return func(cf *requestConfig) {
+		cf.websocket.compression = flag
+	}
+}
+
+//PingInterval opt of DialWebSocket, DefaultPingInterval by default, zero disables the keepalive
+func PingInterval(interval time.Duration) ReqOpt {
+	return func(cf *requestConfig) {
+		cf.websocket.pingInterval = &interval
+	}
+}
+
+//DialWebSocket make the request with the client's base url & default options, then upgrade it to a websocket (RFC 6455).
+//The client's tls config, proxy & dialer, the request's headers, auth & cookies (including the cookie jar's) are all reused.
+//http & https urls are dialed as ws & wss. The context only bounds the handshake.
+//A rejected handshake returns a *StatusError (or *ProblemError).
+func (c *Client) DialWebSocket(ctx context.Context, opts ...ReqOpt) (*WebSocketConn, error) {
+	cf := c.newRequestConfig(opts)
+	req, err := cf.makeRequest()
+	if err != nil {
+		return nil, err
+	}
+	if a := c.authenticator(req); a != nil {
+		if err := a.Authenticate(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	u := *req.URL
+	switch strings.ToLower(u.Scheme) {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return nil, errors.Errorf("%w: %q websocket scheme unsupported", ErrInvalidURL, u.Scheme)
+	}
+	dialer := c.websocketDialer()
+	if socket := cf.options.socket; len(socket) > 0 {
+		if c.config.sockets == nil {
+			return nil, errors.Errorf("%w: unix socket %s unsupported by the custom transport", ErrInvalidURL, socket)
+		}
+		dial := c.config.sockets.dial
+		dialer.Proxy = nil
+		dialer.NetDialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			return dial(ctx, "unix", socket)
+		}
+	}
+	dialer.Subprotocols = cf.websocket.subprotocols
+	dialer.EnableCompression = cf.websocket.compression
+
+	//the handshake headers are set by the dialer
+	header := req.Header.Clone()
+	for _, k := range []string{"Upgrade", "Connection", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Content-Type"} {
+		header.Del(k)
+	}
+	if len(dialer.Subprotocols) > 0 {
+		header.Del("Sec-Websocket-Protocol")
+	}
+	if len(req.Host) > 0 {
+		header.Set("Host", req.Host)
+	}
+	conn, rsp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if err == websocket.ErrBadHandshake && rsp != nil && rsp.StatusCode != http.StatusSwitchingProtocols {
+			defer drainBody(rsp.Body)
+			return nil, responseError(rsp)
+		}
+		return nil, errors.Annotate(err, "websocket dial")
+	}
+	interval := DefaultPingInterval
+	if cf.websocket.pingInterval != nil {
+		interval = *cf.websocket.pingInterval
+	}
+	return newWebSocketConn(conn, interval), nil
+}
+
+//websocketDialer share the tls config, proxy & dialer of the client's transport
+func (c *Client) websocketDialer() *websocket.Dialer {
+	dialer := &websocket.Dialer{
+		HandshakeTimeout: c.config.timeout,
+		Jar:              c.Client.Jar,
+	}
+	rt := c.Client.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	if tr, ok := rt.(*http.Transport); ok {
+		dialer.Proxy = tr.Proxy
+		dialer.NetDialContext = tr.DialContext
+		if tr.TLSClientConfig != nil {
+			dialer.TLSClientConfig = tr.TLSClientConfig.Clone()
+			//the upgrade is http/1.1 only
+			dialer.TLSClientConfig.NextProtos = nil
+		}
+	}
+	return dialer
+}
+
+//WebSocketConn websocket connection, safe for one reader & many writers
+type WebSocketConn struct {
+	conn      *websocket.Conn
+	interval  time.Duration
+	writeMu   sync.Mutex
+	mu        sync.Mutex
+	reading   bool
+	draining  bool
+	done      chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	readOnce  sync.Once
+}
+
+func newWebSocketConn(conn *websocket.Conn, interval time.Duration) *WebSocketConn {
+	ws := &WebSocketConn{
+		conn:     conn,
+		interval: interval,
+		done:     make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	if interval > 0 {
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * interval))
+		})
+		go ws.keepalive()
+	}
+	return ws
+}
+
+func (ws *WebSocketConn) keepalive() {
+	ticker := time.NewTicker(ws.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := ws.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(ws.interval)); err != nil {
+				return
+			}
+		case <-ws.done:
+			return
+		}
+	}
+}
+
+//Subprotocol negotiated with the server, empty if none
+func (ws *WebSocketConn) Subprotocol() string {
+	return ws.conn.Subprotocol()
+}
+
+//Conn the underlying gorilla websocket connection
+func (ws *WebSocketConn) Conn() *websocket.Conn {
+	return ws.conn
+}
+
+//ReadMessage read the next message, returns the message type (TextMessage or BinaryMessage).
+//It fails with a *websocket.CloseError once the peer closes, or an error when the keepalive pongs are missing.
+func (ws *WebSocketConn) ReadMessage() (int, []byte, error) {
+	ws.mu.Lock()
+	if ws.draining {
+		ws.mu.Unlock()
+		return 0, nil, websocket.ErrCloseSent
+	}
+	ws.reading = true
+	ws.mu.Unlock()
+	defer func() {
+		ws.mu.Lock()
+		ws.reading = false
+		ws.mu.Unlock()
+	}()
+	//the pongs extend the deadline while waiting
+	if ws.interval > 0 {
+		ws.conn.SetReadDeadline(time.Now().Add(2 * ws.interval))
+	}
+	mt, b, err := ws.conn.ReadMessage()
+	if err != nil {
+		ws.readOnce.Do(func() { close(ws.closed) })
+	}
+	return mt, b, err
+}
+
+//WriteMessage write a message of the type (TextMessage or BinaryMessage)
+func (ws *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	return ws.conn.WriteMessage(messageType, data)
+}
+
+//Close the connection with the close handshake & normal closure status
+func (ws *WebSocketConn) Close() error {
+	return ws.CloseWithStatus(websocket.CloseNormalClosure, "")
+}
+
+//CloseWithStatus send the close frame of the status code, wait for the peer's close frame
+//at most DefaultCloseTimeout, then close the connection
+func (ws *WebSocketConn) CloseWithStatus(code int, text string) error {
+	err := errors.New("websocket already closed")
+	ws.closeOnce.Do(func() {
+		close(ws.done)
+		deadline := time.Now().Add(DefaultCloseTimeout)
+		msg := websocket.FormatCloseMessage(code, text)
+		//the reader in ReadMessage receives the peer's close frame, otherwise it's drained here & no more read
+		ws.mu.Lock()
+		reading := ws.reading
+		ws.draining = !reading
+		ws.mu.Unlock()
+		if werr := ws.conn.WriteControl(websocket.CloseMessage, msg, deadline); werr == nil {
+			if reading {
+				select {
+				case <-ws.closed:
+				case <-time.After(time.Until(deadline)):
+				}
+			} else {
+				ws.conn.SetReadDeadline(deadline)
+				for {
+					if _, _, rerr := ws.conn.NextReader(); rerr != nil {
+						break
+					}
+				}
+			}
+		}
+		err = ws.conn.Close()
+	})
+	return err
+}